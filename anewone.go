@@ -66,6 +66,9 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/tangsk/newchaincode/compositeindex"
+	"github.com/tangsk/newchaincode/identity"
+	"github.com/tangsk/newchaincode/txevent"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -80,6 +83,29 @@ type work struct {
 	Workexperience      string `json:"workexperience"`
 }
 
+// Chaincode events emitted on every work change. The event name is the
+// event type, the payload is a workEvent.
+const (
+	eventWorkCreated = "WorkCreated"
+	eventWorkDeleted = "WorkDeleted"
+)
+
+type workEvent struct {
+	Type          string   `json:"type"`
+	Uid           string   `json:"uid"`
+	Actor         string   `json:"actor"`
+	TxId          string   `json:"txId"`
+	ChangedFields []string `json:"changedFields"`
+}
+
+// workIndexes declares the composite key indexes of works. Works are written and
+// deleted through it so the index entries follow every change.
+// The composite key is based on indexName~workstartdate~uid, enabling efficient
+// range queries on keys matching indexName~workstartdate~*.
+var workIndexes = compositeindex.NewManager("work",
+	compositeindex.Index{Name: "workstartdate~uid", Fields: []string{"workstartdate", "uid"}},
+)
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -181,26 +207,17 @@ func (t *SimpleChaincode) initWork(stub shim.ChaincodeStubInterface, args []stri
 	//workJSONasString := `{"docType":"Work",  "uid": "` + Uid + `", "workstartdate": "` + workstartdate + `", "workenddate": ` + strconv.Itoa(workenddate) + `, "workexperience": "` + workexperience + `"}`
 	//workJSONasBytes := []byte(str)
 
-	// === Save work to state ===
-	err = stub.PutState(Uid, workJSONasBytes)
+	// === Save work to state and index it to enable workstartdate-based range queries, e.g. return all blue works ===
+	err = workIndexes.PutState(stub, Uid, workJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	//  ==== Index the work to enable workstartdate-based range queries, e.g. return all blue works ====
-	//  An 'index' is a normal key/value entry in state.
-	//  The key is a composite key, with the elements that you want to range query on listed first.
-	//  In our case, the composite key is based on indexUid~workstartdate~uid.
-	//  This will enable very efficient state range queries based on composite keys matching indexUid~workstartdate~*
-	indexUid := "workstartdate~uid"
-	workstartdateUidIndexKey, err := stub.CreateCompositeKey(indexUid, []string{work.Workstartdate, work.Uid})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkCreated, Uid: Uid,
+		ChangedFields: []string{"uid", "workstartdate", "workenddate", "workexperience"}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//  Save index entry to state. Only the key uid is needed, no need to store a duplicate copy of the work.
-	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
-	value := []byte{0x00}
-	stub.PutState(workstartdateUidIndexKey, value)
 
 	// ==== Work saved and indexed. Return success ====
 	fmt.Println("- end init work")
@@ -236,13 +253,11 @@ func (t *SimpleChaincode) readWork(stub shim.ChaincodeStubInterface, args []stri
 // ==================================================
 func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var jsonResp string
-	var workJSON work
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 	Uid := args[0]
 
-	// to maintain the workstartdate~uid index, we need to read the work first and get its workstartdate
 	valAsbytes, err := stub.GetState(Uid) //get the work from chaincode state
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + Uid + "\"}"
@@ -252,33 +267,33 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 		return shim.Error(jsonResp)
 	}
 
-	err = json.Unmarshal([]byte(valAsbytes), &workJSON)
-	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + Uid + "\"}"
-		return shim.Error(jsonResp)
-	}
-
-	err = stub.DelState(Uid) //remove the work from chaincode state
+	err = workIndexes.DelState(stub, Uid) //remove the work and its index entries from chaincode state
 	if err != nil {
 		return shim.Error("Failed to delete state:" + err.Error())
 	}
 
-	// maintain the index
-	indexUid := "workstartdate~uid"
-	workstartdateUidIndexKey, err := stub.CreateCompositeKey(indexUid, []string{workJSON.Workstartdate, workJSON.Uid})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkDeleted, Uid: Uid, ChangedFields: []string{}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	//  Delete index entry to state.
-	err = stub.DelState(workstartdateUidIndexKey)
-	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
-	}
 	return shim.Success(nil)
 }
 
 
+// ===========================================================================================
+// setWorkEvent emits a work event. The contract has no configuration, the actor
+// is named with the default identity strategy.
+// ===========================================================================================
+func setWorkEvent(stub shim.ChaincodeStubInterface, event workEvent) error {
+	return txevent.Emit(stub, identity.Config{}, event.Type, &event)
+}
+
+// SetOrigin records the submitter and the transaction of the event, see txevent.Emit
+func (e *workEvent) SetOrigin(actor string, txId string) {
+	e.Actor = actor
+	e.TxId = txId
+}
+
 // ===== Example: Ad hoc rich query ========================================================
 // queryWorks uses a query string to perform a query for works.
 // Query string matching state database syntax is passed in and executed as is.
@@ -10,6 +10,9 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/tangsk/newchaincode/compositeindex"
+	"github.com/tangsk/newchaincode/identity"
+	"github.com/tangsk/newchaincode/txevent"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -24,6 +27,30 @@ type work struct {
 	WorkEndDate      string `json:"workEndDate"`      // 工作终止日期
 }
 
+// Chaincode events emitted on every work change. The event name is the
+// event type, the payload is a workEvent. Fabric delivers only the last event
+// set in a transaction, so transferworksBasedOnworkexperience emits one event listing all works.
+const (
+	eventWorkCreated     = "WorkCreated"
+	eventWorkTransferred = "WorkTransferred"
+	eventWorkDeleted     = "WorkDeleted"
+)
+
+type workEvent struct {
+	Type          string   `json:"type"`
+	Uid           string   `json:"uid,omitempty"`
+	Uids          []string `json:"uids,omitempty"` //set instead of uid when several works changed
+	Actor         string   `json:"actor"`
+	TxId          string   `json:"txId"`
+	ChangedFields []string `json:"changedFields"`
+}
+
+// 工作经历的索引，initwork、transferwork和delete通过它读写状态，索引随记录自动增删
+// 联合主键为workexperience~uid，按工作经历范围查询记录
+var workIndexes = compositeindex.NewManager("work",
+	compositeindex.Index{Name: "workexperience~uid", Fields: []string{"workexperience", "uid"}},
+)
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -84,25 +111,18 @@ func (t *SimpleChaincode) initwork(stub shim.ChaincodeStubInterface, args []stri
 	// ==== Input sanitation ====
 	fmt.Println("- start init work")
 	if len(args[0]) != 32 {
-		return fmt.Errorf("Parameter uid length error while Work, 32 is right")
+		return shim.Error("Parameter uid length error while Work, 32 is right")
 	}
 	if len(args[3]) != 14 {
-		return fmt.Errorf("Parameter WorkStartDate length error while Work, 14 is right")
+		return shim.Error("Parameter WorkStartDate length error while Work, 14 is right")
 	}
 	if len(args[4]) != 14 {
-		return fmt.Errorf("Parameter WorkEndDate length error while Work, 14 is right")
+		return shim.Error("Parameter WorkEndDate length error while Work, 14 is right")
 	}
 	uid           := args[0]
 	workexperience:= args[1]
-	objectType    := args[2]
 	workstartdate := args[3]
 	workenddate   := args[4]
-	key, err := strconv.Atoi(args[5])
-	if err != nil {
-		return shim.Error("Json serialize Work fail while Work, work id = " + args[5])
-	}
-
-	
 
 	// ==== Check if work already exists ====
 	workJsonBytes, err := stub.GetState(uid)
@@ -115,29 +135,24 @@ func (t *SimpleChaincode) initwork(stub shim.ChaincodeStubInterface, args []stri
 
 	// ==== Create work object and marshal to JSON ====
 	objectType := "work"
-	work := &work{uid, workexperience, objectType, workstartdate, workenddate}
+	work := &work{ObjectType: objectType, Uid: uid, Workexperience: workexperience, WorkStartDate: workstartdate, WorkEndDate: workenddate}
 	workJSONJsonBytes, err := json.Marshal(work)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 
-	// === Save work to state ===
-	err = stub.PutState(uid, workJSONJsonBytes)
+	// === Save work to state, the workexperience~uid index entry is added with it ===
+	err = workIndexes.PutState(stub, uid, workJSONJsonBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-
-	indexName := "workexperience~name"
-	workexperienceNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{work.workexperience, work.Name})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkCreated, Uid: uid,
+		ChangedFields: []string{"uid", "workexperience", "workStartDate", "workEndDate"}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//  Save index entry to state. Only the key name is needed, no need to store a duplicate copy of the work.
-	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
-	value := []byte{0x00}
-	stub.PutState(workexperienceNameIndexKey, value)
 
 	// ==== work saved and indexed. Return success ====
 	fmt.Println("- end init work")
@@ -179,7 +194,6 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 	}
 	uid := args[0]
 
-	// to maintain the workexperience~name index, we need to read the work first and get its workexperience
 	valJsonBytes, err := stub.GetState(uid) //get the work from chaincode state
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + uid + "\"}"
@@ -195,23 +209,15 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 		return shim.Error(jsonResp)
 	}
 
-	err = stub.DelState(uid) //remove the work from chaincode state
+	err = workIndexes.DelState(stub, uid) //remove the work and its index entries from chaincode state
 	if err != nil {
 		return shim.Error("Failed to delete state:" + err.Error())
 	}
 
-	// maintain the index
-	indexName := "workexperience~name"
-	workexperienceNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{workJSON.workexperience, workJSON.Name})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkDeleted, Uid: uid, ChangedFields: []string{}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	//  Delete index entry to state.
-	err = stub.DelState(workexperienceNameIndexKey)
-	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
-	}
 	return shim.Success(nil)
 }
 
@@ -242,10 +248,15 @@ func (t *SimpleChaincode) transferwork(stub shim.ChaincodeStubInterface, args []
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	workToTransfer.workstartdate = newworkstartdate //change the workstartdate
+	workToTransfer.WorkStartDate = newworkstartdate //change the workstartdate
 
 	workJSONJsonBytes, _ := json.Marshal(workToTransfer)
-	err = stub.PutState(uid, workJSONJsonBytes) //rewrite the work
+	err = workIndexes.PutState(stub, uid, workJSONJsonBytes) //rewrite the work and move its index entries
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setWorkEvent(stub, workEvent{Type: eventWorkTransferred, Uid: uid, ChangedFields: []string{"workStartDate"}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -255,6 +266,20 @@ func (t *SimpleChaincode) transferwork(stub shim.ChaincodeStubInterface, args []
 }
 
 
+// ===========================================================================================
+// setWorkEvent emits a work event. The contract has no configuration, the actor
+// is named with the default identity strategy.
+// ===========================================================================================
+func setWorkEvent(stub shim.ChaincodeStubInterface, event workEvent) error {
+	return txevent.Emit(stub, identity.Config{}, event.Type, &event)
+}
+
+// SetOrigin records the submitter and the transaction of the event, see txevent.Emit
+func (e *workEvent) SetOrigin(actor string, txId string) {
+	e.Actor = actor
+	e.TxId = txId
+}
+
 func (t *SimpleChaincode) getworksByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	if len(args) < 2 {
@@ -315,9 +340,9 @@ func (t *SimpleChaincode) transferworksBasedOnworkexperience(stub shim.Chaincode
 	newworkstartdate := strings.ToLower(args[1])
 	fmt.Println("- start transferworksBasedOnworkexperience ", workexperience, newworkstartdate)
 
-	// Query the workexperience~name index by workexperience
+	// Query the workexperience~uid index by workexperience
 	// This will execute a key range query on all keys starting with 'workexperience'
-	workexperienceedworkResultsIterator, err := stub.GetStateByPartialCompositeKey("workexperience~name", []string{workexperience})
+	workexperienceedworkResultsIterator, err := stub.GetStateByPartialCompositeKey("workexperience~uid", []string{workexperience})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -325,21 +350,22 @@ func (t *SimpleChaincode) transferworksBasedOnworkexperience(stub shim.Chaincode
 
 	// Iterate through result set and for each work found, transfer to newworkstartdate
 	var i int
+	var transferredUids []string
 	for i = 0; workexperienceedworkResultsIterator.HasNext(); i++ {
-		// Note that we don't get the value (2nd return variable), we'll just get the work name from the composite key
+		// Note that we don't get the value (2nd return variable), we'll just get the work uid from the composite key
 		responseRange, err := workexperienceedworkResultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
 
-		// get the workexperience and name from workexperience~name composite key
+		// get the workexperience and uid from workexperience~uid composite key
 		objectType, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
 		returnedworkexperience := compositeKeyParts[0]
 		returneduid := compositeKeyParts[1]
-		fmt.Printf("- found a work from index:%s workexperience:%s name:%s\n", objectType, returnedworkexperience, returneduid)
+		fmt.Printf("- found a work from index:%s workexperience:%s uid:%s\n", objectType, returnedworkexperience, returneduid)
 
 		// Now call the transfer function for the found work.
 		// Re-use the same function that is used to transfer individual works
@@ -348,6 +374,15 @@ func (t *SimpleChaincode) transferworksBasedOnworkexperience(stub shim.Chaincode
 		if response.Status != shim.OK {
 			return shim.Error("Transfer failed: " + response.Message)
 		}
+		transferredUids = append(transferredUids, returneduid)
+	}
+
+	// each transferwork replaced the event of the one before, emit one for all of them
+	if i > 0 {
+		err = setWorkEvent(stub, workEvent{Type: eventWorkTransferred, Uids: transferredUids, ChangedFields: []string{"workStartDate"}})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
 
 	responsePayload := fmt.Sprintf("Transferred %d %s works to %s", i, workexperience, newworkstartdate)
@@ -10,6 +10,10 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/tangsk/newchaincode/compositeindex"
+	"github.com/tangsk/newchaincode/identity"
+	"github.com/tangsk/newchaincode/txevent"
+	"github.com/tangsk/newchaincode/workdate"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -25,6 +29,32 @@ type work struct {
 	WorkEndDate      string `json:"workEndDate"`      // 工作终止日期
 }
 
+// Chaincode events emitted on every work change. The event name is the
+// event type, the payload is a workEvent. Fabric delivers only the last event
+// set in a transaction, so transferworksBasedOnWorkStartDate emits one event listing all works.
+const (
+	eventWorkCreated     = "WorkCreated"
+	eventWorkTransferred = "WorkTransferred"
+	eventWorkDeleted     = "WorkDeleted"
+)
+
+type workEvent struct {
+	Type          string   `json:"type"`
+	Uid           string   `json:"uid,omitempty"`
+	Uids          []string `json:"uids,omitempty"` //set instead of uid when several works changed
+	Actor         string   `json:"actor"`
+	TxId          string   `json:"txId"`
+	ChangedFields []string `json:"changedFields"`
+}
+
+// workIndexes declares the composite key indexes of works. initwork, transferwork and
+// delete write through it so the index entries follow every change.
+// The composite key is based on indexName~workStartDate~uid, enabling efficient
+// range queries on keys matching indexName~workStartDate~*.
+var workIndexes = compositeindex.NewManager("work",
+	compositeindex.Index{Name: "workStartDate~uid", Fields: []string{"workStartDate", "uid"}},
+)
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -35,7 +65,54 @@ func main() {
 	}
 }
 
+// contractConfig is the optional configuration passed to Init or updateConfig, e.g.
+// {"identityStrategy":"cnRegex","identityPattern":"^([^@]+)@","adminMSPs":["Org1MSP"],"dateFormat":"2006-01-02","timezone":"+08:00"}
+// Every stored version is kept under configHistory~version.
+type contractConfig struct {
+	identity.Config          //how callers are named, see the identity package
+	AdminMSPs       []string `json:"adminMSPs,omitempty"`  //MSP IDs allowed to change the configuration, Org1MSP by default
+	DateFormat      string   `json:"dateFormat,omitempty"` //Go layout of input dates, yyyyMMddHHmmss and ISO-8601 are always accepted
+	Timezone        string   `json:"timezone,omitempty"`   //UTC or a fixed offset like +08:00 of dates without a zone, UTC by default
+	Version         int      `json:"version"`
+	TxId            string   `json:"txId"`
+	UpdatedBy       string   `json:"updatedBy"`
+}
+
+// defaultAdminMSPs may change the configuration unless adminMSPs is configured
+var defaultAdminMSPs = []string{"Org1MSP"}
+
+// Init stores the optional configuration. On upgrade without arguments the stored
+// configuration is kept. Once a configuration is stored, only admins may replace it
+// through Init, as with updateConfig.
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	// an upgrade by any org must not rewrite the configuration
+	configured, err := hasContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if configured {
+		err = authorizeAdmin(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	config, err := parseContractConfig(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putContractConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -49,22 +126,26 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	// Handle different functions
 	if function == "initwork" { //create a new work
 		return t.initwork(stub, args)
-	} else if function == "transferwork" { //change owner of a specific work
+	} else if function == "transferwork" { //change workexperience of a specific work
 		return t.transferwork(stub, args)
-	} else if function == "transferworksBasedOnColor" { //transfer all works of a certain color
-		return t.transferworksBasedOnColor(stub, args)
+	} else if function == "transferworksBasedOnWorkStartDate" || function == "transferworksBasedOnColor" { //transfer all works of a certain workStartDate, the old name is kept for existing clients
+		return t.transferworksBasedOnWorkStartDate(stub, args)
 	} else if function == "delete" { //delete a work
 		return t.delete(stub, args)
 	} else if function == "readwork" { //read a work
 		return t.readwork(stub, args)
-	} else if function == "queryworksByOwner" { //find works for  X using rich query
-		return t.queryworksByOwner(stub, args)
+	} else if function == "queryworksByWorkexperience" || function == "queryworksByOwner" { //find works for workexperience X using rich query, the old name is kept for existing clients
+		return t.queryworksByWorkexperience(stub, args)
 	} else if function == "queryworks" { //find works based on an ad hoc rich query
 		return t.queryworks(stub, args)
 	} else if function == "getHistoryForwork" { //get history of values for a work
 		return t.getHistoryForwork(stub, args)
 	} else if function == "getworksByRange" { //get works based on range query
 		return t.getworksByRange(stub, args)
+	} else if function == "updateConfig" { //replace the contract configuration
+		return t.updateConfig(stub, args)
+	} else if function == "getConfigHistory" { //get every version of the contract configuration
+		return t.getConfigHistory(stub, args)
 	}
 
 	fmt.Println("invoke did not find func: " + function) //error
@@ -85,28 +166,37 @@ func (t *SimpleChaincode) initwork(stub shim.ChaincodeStubInterface, args []stri
 	// ==== Input sanitation ====
 	fmt.Println("- start init work")
 	if len(args[0]) != 32 {
-		return fmt.Errorf("Parameter uid length error while Work, 32 is right")
+		return shim.Error("Parameter uid length error while Work, 32 is right")
+	}
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	if len(args[2]) != 14 {
-		return fmt.Errorf("Parameter ApplyDate length error while Work, 14 is right")
+	location, err := workdate.Location(config.Timezone)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	applydate, err := workdate.Parse(args[2], config.DateFormat, location)
+	if err != nil {
+		return shim.Error("Parameter ApplyDate error while Work: " + err.Error())
 	}
-	if len(args[3]) != 14 {
-		return fmt.Errorf("Parameter WorkStartDate length error while Work, 14 is right")
+	workstartdate, err := workdate.Parse(args[3], config.DateFormat, location)
+	if err != nil {
+		return shim.Error("Parameter WorkStartDate error while Work: " + err.Error())
 	}
-	if len(args[4]) != 14 {
-		return fmt.Errorf("Parameter WorkEndDate length error while Work, 14 is right")
+	workenddate, err := workdate.Parse(args[4], config.DateFormat, location)
+	if err != nil {
+		return shim.Error("Parameter WorkEndDate error while Work: " + err.Error())
+	}
+	if !workenddate.After(workstartdate) {
+		return shim.Error("Parameter WorkEndDate error while Work, must be after WorkStartDate")
 	}
 	uid           := args[0]
 	workexperience:= args[1]
-	applydate     := args[2]
-	workstartdate := args[3]
-	workenddate   := args[4]
-	key, err := strconv.Atoi(args[5])
-	if err != nil {
-		return shim.Error("Json serialize Work fail while Work, work id = " + args[5])
+	if _, err = strconv.Atoi(args[5]); err != nil {
+		return shim.Error("Parameter work id must be numeric, work id = " + args[5])
 	}
 
-	
 
 	// ==== Check if work already exists ====
 	workJsonBytes, err := stub.GetState(uid)
@@ -119,7 +209,7 @@ func (t *SimpleChaincode) initwork(stub shim.ChaincodeStubInterface, args []stri
 
 	// ==== Create work object and marshal to JSON ====
 	objectType := "work"
-	work := &work{objectType, uid, color, key, owner}
+	work := &work{objectType, uid, workexperience, workdate.Format(applydate), workdate.Format(workstartdate), workdate.Format(workenddate)}
 	workJSONJsonBytes, err := json.Marshal(work)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -128,32 +218,231 @@ func (t *SimpleChaincode) initwork(stub shim.ChaincodeStubInterface, args []stri
 	//workJSONasString := `{"docType":"work",  "name": "` + uid + `", "color": "` + color + `", "key": ` + strconv.Itoa(key) + `, "owner": "` + owner + `"}`
 	//workJSONJsonBytes := []byte(str)
 
-	// === Save work to state ===
-	err = stub.PutState(uid, workJSONJsonBytes)
+	// === Save work to state, indexed to enable start date based range queries ===
+	err = workIndexes.PutState(stub, uid, workJSONJsonBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	//  ==== Index the work to enable color-based range queries, e.g. return all blue works ====
-	//  An 'index' is a normal key/value entry in state.
-	//  The key is a composite key, with the elements that you want to range query on listed first.
-	//  In our case, the composite key is based on indexName~color~name.
-	//  This will enable very efficient state range queries based on composite keys matching indexName~color~*
-	indexName := "color~name"
-	colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{work.Color, work.Name})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkCreated, Uid: uid,
+		ChangedFields: []string{"uid", "workexperience", "applyDate", "workStartDate", "workEndDate"}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//  Save index entry to state. Only the key name is needed, no need to store a duplicate copy of the work.
-	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
-	value := []byte{0x00}
-	stub.PutState(colorNameIndexKey, value)
 
 	// ==== work saved and indexed. Return success ====
 	fmt.Println("- end init work")
 	return shim.Success(nil)
 }
 
+// ===============================================
+// getContractConfig reads the stored configuration
+// ===============================================
+func getContractConfig(stub shim.ChaincodeStubInterface) (*contractConfig, error) {
+	configKey, err := stub.CreateCompositeKey("config", []string{"contract"})
+	if err != nil {
+		return nil, err
+	}
+	configJSONasBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get configuration: %s", err)
+	}
+	config := &contractConfig{Config: identity.Config{Strategy: identity.StrategyMSPEnrollment}}
+	if configJSONasBytes == nil {
+		return config, nil
+	}
+	err = json.Unmarshal(configJSONasBytes, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode configuration: %s", err)
+	}
+	return config, nil
+}
+
+// hasContractConfig reports whether a configuration is stored
+func hasContractConfig(stub shim.ChaincodeStubInterface) (bool, error) {
+	configKey, err := stub.CreateCompositeKey("config", []string{"contract"})
+	if err != nil {
+		return false, err
+	}
+	configJSONasBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get configuration: %s", err)
+	}
+	return configJSONasBytes != nil, nil
+}
+
+// ===============================================
+// parseContractConfig decodes and validates a configuration document
+// ===============================================
+func parseContractConfig(configJSON string) (*contractConfig, error) {
+	config := &contractConfig{Config: identity.Config{Strategy: identity.StrategyMSPEnrollment}}
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode configuration JSON: %s", err)
+	}
+
+	if _, err = identity.NewResolver(config.Config); err != nil {
+		return nil, err
+	}
+	for _, mspId := range config.AdminMSPs {
+		if strings.TrimSpace(mspId) == "" {
+			return nil, fmt.Errorf("adminMSPs must not hold empty MSP IDs")
+		}
+	}
+	if config.DateFormat != "" {
+		if err = workdate.CheckLayout(config.DateFormat); err != nil {
+			return nil, fmt.Errorf("Invalid dateFormat: %s", err)
+		}
+	}
+	if _, err = workdate.Location(config.Timezone); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ===============================================
+// putContractConfig stores config as the next version of the
+// configuration and keeps a copy in the configuration history
+// ===============================================
+func putContractConfig(stub shim.ChaincodeStubInterface, config *contractConfig) error {
+	current, err := getContractConfig(stub)
+	if err != nil {
+		return err
+	}
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return err
+	}
+	// name the caller the way the new configuration would
+	resolver, err := identity.NewResolver(config.Config)
+	if err != nil {
+		return err
+	}
+	config.UpdatedBy, err = resolver.Resolve(caller)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve caller name: %s", err)
+	}
+	config.Version = current.Version + 1
+	config.TxId = stub.GetTxID()
+
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	configKey, err := stub.CreateCompositeKey("config", []string{"contract"})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(configKey, configJSONasBytes)
+	if err != nil {
+		return err
+	}
+	historyKey, err := stub.CreateCompositeKey("configHistory", []string{fmt.Sprintf("%010d", config.Version)})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(historyKey, configJSONasBytes)
+}
+
+// ===============================================
+// authorizeAdmin checks that the caller belongs to
+// an admin MSP of the stored configuration
+// ===============================================
+func authorizeAdmin(stub shim.ChaincodeStubInterface) error {
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return err
+	}
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return err
+	}
+	adminMSPs := config.AdminMSPs
+	if len(adminMSPs) == 0 {
+		adminMSPs = defaultAdminMSPs
+	}
+	for _, mspId := range adminMSPs {
+		if caller.MSPID == mspId {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not authorized, expecting one of the admin MSPs %s", caller.MSPID, strings.Join(adminMSPs, ", "))
+}
+
+// ===========================================================
+// updateConfig replaces the contract configuration.
+// The new document is validated like the one passed to Init,
+// the previous versions stay available through getConfigHistory.
+// Only admins may update the configuration.
+// ===========================================================
+func (t *SimpleChaincode) updateConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "{...}"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	err := authorizeAdmin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := parseContractConfig(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putContractConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(configJSONasBytes)
+}
+
+// ===========================================================
+// getConfigHistory returns every stored version of the
+// contract configuration, oldest first
+// ===========================================================
+func (t *SimpleChaincode) getConfigHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("configHistory", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing the configuration versions
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
 // ===============================================
 // readwork - read a work from chaincode state
 // ===============================================
@@ -189,7 +478,6 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 	}
 	uid := args[0]
 
-	// to maintain the color~name index, we need to read the work first and get its color
 	valJsonBytes, err := stub.GetState(uid) //get the work from chaincode state
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + uid + "\"}"
@@ -205,40 +493,32 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 		return shim.Error(jsonResp)
 	}
 
-	err = stub.DelState(uid) //remove the work from chaincode state
+	err = workIndexes.DelState(stub, uid) //remove the work and its index entries from chaincode state
 	if err != nil {
 		return shim.Error("Failed to delete state:" + err.Error())
 	}
 
-	// maintain the index
-	indexName := "color~name"
-	colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{workJSON.Color, workJSON.Name})
+	err = setWorkEvent(stub, workEvent{Type: eventWorkDeleted, Uid: uid, ChangedFields: []string{}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	//  Delete index entry to state.
-	err = stub.DelState(colorNameIndexKey)
-	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
-	}
 	return shim.Success(nil)
 }
 
 // ===========================================================
-// transfer a work by setting a new owner name on the work
+// transfer a work by setting a new workexperience on the work
 // ===========================================================
 func (t *SimpleChaincode) transferwork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	//   0       1
-	// "name", "bob"
+	// "uid", "bob"
 	if len(args) < 2 {
 		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
 	uid := args[0]
-	newOwner := strings.ToLower(args[1])
-	fmt.Println("- start transferwork ", uid, newOwner)
+	newWorkexperience := strings.ToLower(args[1])
+	fmt.Println("- start transferwork ", uid, newWorkexperience)
 
 	workJsonBytes, err := stub.GetState(uid)
 	if err != nil {
@@ -252,10 +532,15 @@ func (t *SimpleChaincode) transferwork(stub shim.ChaincodeStubInterface, args []
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	workToTransfer.Owner = newOwner //change the owner
+	workToTransfer.Workexperience = newWorkexperience //change the workexperience
 
 	workJSONJsonBytes, _ := json.Marshal(workToTransfer)
-	err = stub.PutState(uid, workJSONJsonBytes) //rewrite the work
+	err = workIndexes.PutState(stub, uid, workJSONJsonBytes) //rewrite the work and move its index entries
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setWorkEvent(stub, workEvent{Type: eventWorkTransferred, Uid: uid, ChangedFields: []string{"workexperience"}})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -264,6 +549,23 @@ func (t *SimpleChaincode) transferwork(stub shim.ChaincodeStubInterface, args []
 	return shim.Success(nil)
 }
 
+// ===========================================================================================
+// setWorkEvent emits a work event, the actor is named with the configured identity strategy
+// ===========================================================================================
+func setWorkEvent(stub shim.ChaincodeStubInterface, event workEvent) error {
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return err
+	}
+	return txevent.Emit(stub, config.Config, event.Type, &event)
+}
+
+// SetOrigin records the submitter and the transaction of the event, see txevent.Emit
+func (e *workEvent) SetOrigin(actor string, txId string) {
+	e.Actor = actor
+	e.TxId = txId
+}
+
 // ===========================================================================================
 // getworksByRange performs a range query based on the start and end keys provided.
 
@@ -323,62 +625,84 @@ func (t *SimpleChaincode) getworksByRange(stub shim.ChaincodeStubInterface, args
 }
 
 // ==== Example: GetStateByPartialCompositeKey/RangeQuery =========================================
-// transferworksBasedOnColor will transfer works of a given color to a certain new owner.
-// Uses a GetStateByPartialCompositeKey (range query) against color~name 'index'.
+// transferworksBasedOnWorkStartDate will transfer works of a given workStartDate to a certain new workexperience.
+// Uses a GetStateByPartialCompositeKey (range query) against workStartDate~uid 'index'.
 // Committing peers will re-execute range queries to guarantee that result sets are stable
 // between endorsement time and commit time. The transaction is invalidated by the
 // committing peers if the result set has changed between endorsement time and commit time.
 // Therefore, range queries are a safe option for performing update transactions based on query results.
 // ===========================================================================================
-func (t *SimpleChaincode) transferworksBasedOnColor(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *SimpleChaincode) transferworksBasedOnWorkStartDate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0       1
-	// "color", "bob"
+	//   0                 1
+	// "20150301090000", "bob"
 	if len(args) < 2 {
 		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
-	color := args[0]
-	newOwner := strings.ToLower(args[1])
-	fmt.Println("- start transferworksBasedOnColor ", color, newOwner)
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	location, err := workdate.Location(config.Timezone)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the index holds the stored form of the date, a date given in that form is taken as stored
+	workStartDate, err := workdate.NormalizeKey(args[0], config.DateFormat, location)
+	if err != nil {
+		return shim.Error("Parameter WorkStartDate error: " + err.Error())
+	}
+	newWorkexperience := strings.ToLower(args[1])
+	fmt.Println("- start transferworksBasedOnWorkStartDate ", workStartDate, newWorkexperience)
 
-	// Query the color~name index by color
-	// This will execute a key range query on all keys starting with 'color'
-	coloredworkResultsIterator, err := stub.GetStateByPartialCompositeKey("color~name", []string{color})
+	// Query the workStartDate~uid index by workStartDate
+	// This will execute a key range query on all keys starting with 'workStartDate'
+	startedWorkResultsIterator, err := stub.GetStateByPartialCompositeKey("workStartDate~uid", []string{workStartDate})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer coloredworkResultsIterator.Close()
+	defer startedWorkResultsIterator.Close()
 
-	// Iterate through result set and for each work found, transfer to newOwner
+	// Iterate through result set and for each work found, transfer to newWorkexperience
 	var i int
-	for i = 0; coloredworkResultsIterator.HasNext(); i++ {
-		// Note that we don't get the value (2nd return variable), we'll just get the work name from the composite key
-		responseRange, err := coloredworkResultsIterator.Next()
+	var transferredUids []string
+	for i = 0; startedWorkResultsIterator.HasNext(); i++ {
+		// Note that we don't get the value (2nd return variable), we'll just get the uid from the composite key
+		responseRange, err := startedWorkResultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
 
-		// get the color and name from color~name composite key
+		// get the workStartDate and uid from workStartDate~uid composite key
 		objectType, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		returnedColor := compositeKeyParts[0]
+		returnedWorkStartDate := compositeKeyParts[0]
 		returneduid := compositeKeyParts[1]
-		fmt.Printf("- found a work from index:%s color:%s name:%s\n", objectType, returnedColor, returneduid)
+		fmt.Printf("- found a work from index:%s workStartDate:%s uid:%s\n", objectType, returnedWorkStartDate, returneduid)
 
 		// Now call the transfer function for the found work.
 		// Re-use the same function that is used to transfer individual works
-		response := t.transferwork(stub, []string{returneduid, newOwner})
+		response := t.transferwork(stub, []string{returneduid, newWorkexperience})
 		// if the transfer failed break out of loop and return error
 		if response.Status != shim.OK {
 			return shim.Error("Transfer failed: " + response.Message)
 		}
+		transferredUids = append(transferredUids, returneduid)
+	}
+
+	// each transferwork replaced the event of the one before, emit one for all of them
+	if i > 0 {
+		err = setWorkEvent(stub, workEvent{Type: eventWorkTransferred, Uids: transferredUids, ChangedFields: []string{"workexperience"}})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
 
-	responsePayload := fmt.Sprintf("Transferred %d %s works to %s", i, color, newOwner)
-	fmt.Println("- end transferworksBasedOnColor: " + responsePayload)
+	responsePayload := fmt.Sprintf("Transferred %d %s works to %s", i, workStartDate, newWorkexperience)
+	fmt.Println("- end transferworksBasedOnWorkStartDate: " + responsePayload)
 	return shim.Success([]byte(responsePayload))
 }
 
@@ -396,12 +720,12 @@ func (t *SimpleChaincode) transferworksBasedOnColor(stub shim.ChaincodeStubInter
 // ============================================================================================
 
 // ===== Example: Parameterized rich query =================================================
-// queryworksByOwner queries for works based on a passed in owner.
+// queryworksByWorkexperience queries for works based on a passed in workexperience.
 // This is an example of a parameterized query where the query logic is baked into the chaincode,
-// and accepting a single query parameter (owner).
+// and accepting a single query parameter (workexperience).
 // Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
-func (t *SimpleChaincode) queryworksByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *SimpleChaincode) queryworksByWorkexperience(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	//   0
 	// "bob"
@@ -409,9 +733,9 @@ func (t *SimpleChaincode) queryworksByOwner(stub shim.ChaincodeStubInterface, ar
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	owner := strings.ToLower(args[0])
+	workexperience := strings.ToLower(args[0])
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"work\",\"owner\":\"%s\"}}", owner)
+	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"work\",\"workexperience\":\"%s\"}}", workexperience)
 
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
@@ -424,7 +748,7 @@ func (t *SimpleChaincode) queryworksByOwner(stub shim.ChaincodeStubInterface, ar
 // queryworks uses a query string to perform a query for works.
 // Query string matching state database syntax is passed in and executed as is.
 // Supports ad hoc queries that can be defined at runtime by the client.
-// If this is not desired, follow the queryworksForOwner example for parameterized queries.
+// If this is not desired, follow the queryworksByWorkexperience example for parameterized queries.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
 func (t *SimpleChaincode) queryworks(stub shim.ChaincodeStubInterface, args []string) pb.Response {
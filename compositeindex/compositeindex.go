@@ -0,0 +1,268 @@
+// Package compositeindex maintains composite key indexes for chaincode documents.
+//
+// Each document type declares its indexes once, e.g.
+//
+//	var workIndexes = compositeindex.NewManager("work",
+//		compositeindex.Index{Name: "workstartdate~workId", Fields: []string{"workstartdate", "workId"}},
+//	)
+//
+// and writes and deletes its documents through the manager instead of the stub.
+// The manager adds, moves and removes the index entries on every PutState and DelState,
+// so an index can not drift from the documents when an indexed field changes.
+package compositeindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Index is a composite key index over the top level JSON fields of a document.
+// The composite key is built from the object type Name and the values of Fields,
+// in order. Documents with a missing or empty indexed field are left out of the index.
+type Index struct {
+	Name   string
+	Fields []string
+}
+
+// Manager keeps the indexes of one document type in step with its documents.
+type Manager struct {
+	docType string
+	indexes []Index
+}
+
+// Only the key is needed, no need to store a duplicate copy of the document.
+// Passing a nil value would effectively delete the key from state, therefore we store the null character.
+var entryValue = []byte{0x00}
+
+// NewManager returns a manager for the documents of docType with the given indexes.
+func NewManager(docType string, indexes ...Index) *Manager {
+	return &Manager{docType: docType, indexes: indexes}
+}
+
+// DocType returns the document type the manager indexes.
+func (m *Manager) DocType() string {
+	return m.docType
+}
+
+// Indexes returns the declared indexes.
+func (m *Manager) Indexes() []Index {
+	return m.indexes
+}
+
+// Index returns the declared index called name.
+func (m *Manager) Index(name string) (Index, bool) {
+	for _, index := range m.indexes {
+		if index.Name == name {
+			return index, true
+		}
+	}
+	return Index{}, false
+}
+
+// PutState writes value under key and brings every index entry of the document up to date.
+// Entries of the previous value that no longer match are deleted, missing ones are added.
+// The previous value is read from the committed state, so write a key at most once per transaction.
+func (m *Manager) PutState(stub shim.ChaincodeStubInterface, key string, value []byte) error {
+	oldValue, err := stub.GetState(key)
+	if err != nil {
+		return fmt.Errorf("Failed to get state for %s: %s", key, err)
+	}
+	oldKeys, err := m.entryKeys(stub, oldValue)
+	if err != nil {
+		return fmt.Errorf("Failed to index previous value of %s: %s", key, err)
+	}
+	newKeys, err := m.entryKeys(stub, value)
+	if err != nil {
+		return fmt.Errorf("Failed to index %s: %s", key, err)
+	}
+
+	err = stub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+
+	for indexKey := range oldKeys {
+		if newKeys[indexKey] {
+			continue
+		}
+		err = stub.DelState(indexKey)
+		if err != nil {
+			return fmt.Errorf("Failed to delete index entry: %s", err)
+		}
+	}
+	for indexKey := range newKeys {
+		if oldKeys[indexKey] {
+			continue
+		}
+		err = stub.PutState(indexKey, entryValue)
+		if err != nil {
+			return fmt.Errorf("Failed to put index entry: %s", err)
+		}
+	}
+	return nil
+}
+
+// DelState deletes key and every index entry of the document stored under it.
+func (m *Manager) DelState(stub shim.ChaincodeStubInterface, key string) error {
+	oldValue, err := stub.GetState(key)
+	if err != nil {
+		return fmt.Errorf("Failed to get state for %s: %s", key, err)
+	}
+	oldKeys, err := m.entryKeys(stub, oldValue)
+	if err != nil {
+		return fmt.Errorf("Failed to index previous value of %s: %s", key, err)
+	}
+
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+
+	for indexKey := range oldKeys {
+		err = stub.DelState(indexKey)
+		if err != nil {
+			return fmt.Errorf("Failed to delete index entry: %s", err)
+		}
+	}
+	return nil
+}
+
+// EntryKey returns the composite key the document value has in index.
+// ok is false if the document is not part of the index.
+func (m *Manager) EntryKey(stub shim.ChaincodeStubInterface, index Index, value []byte) (string, bool, error) {
+	fields, err := m.decode(value)
+	if err != nil || fields == nil {
+		return "", false, err
+	}
+	return entryKey(stub, index, fields)
+}
+
+// EnsureEntry writes the entry the document value has in index if it is missing from state.
+// It returns the entry key and whether it had to be added.
+func (m *Manager) EnsureEntry(stub shim.ChaincodeStubInterface, index Index, value []byte) (string, bool, error) {
+	indexKey, ok, err := m.EntryKey(stub, index, value)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	existing, err := stub.GetState(indexKey)
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to get index entry: %s", err)
+	}
+	if existing != nil {
+		return indexKey, false, nil
+	}
+	err = stub.PutState(indexKey, entryValue)
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to put index entry: %s", err)
+	}
+	return indexKey, true, nil
+}
+
+// HasEntry reports whether the entry the document value has in index is in state.
+// Documents that are not part of the index always have their entry.
+func (m *Manager) HasEntry(stub shim.ChaincodeStubInterface, index Index, value []byte) (string, bool, error) {
+	indexKey, ok, err := m.EntryKey(stub, index, value)
+	if err != nil || !ok {
+		return "", true, err
+	}
+	existing, err := stub.GetState(indexKey)
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to get index entry: %s", err)
+	}
+	return indexKey, existing != nil, nil
+}
+
+// IsOrphaned reports whether an entry of index points to a document that
+// does not exist or no longer has this entry. The last attribute of an entry
+// is taken as the key of the document it points to.
+func (m *Manager) IsOrphaned(stub shim.ChaincodeStubInterface, index Index, indexKey string) (bool, error) {
+	objectType, attributes, err := stub.SplitCompositeKey(indexKey)
+	if err != nil {
+		return false, err
+	}
+	if objectType != index.Name || len(attributes) == 0 {
+		return true, nil
+	}
+	value, err := stub.GetState(attributes[len(attributes)-1])
+	if err != nil {
+		return false, fmt.Errorf("Failed to get state for %s: %s", attributes[len(attributes)-1], err)
+	}
+	expected, ok, err := m.EntryKey(stub, index, value)
+	if err != nil {
+		// a document that can not be decoded does not hold any entry
+		return true, nil
+	}
+	return !ok || expected != indexKey, nil
+}
+
+// entryKeys returns the set of index entry keys of a document value
+func (m *Manager) entryKeys(stub shim.ChaincodeStubInterface, value []byte) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	fields, err := m.decode(value)
+	if err != nil || fields == nil {
+		return keys, err
+	}
+	for _, index := range m.indexes {
+		indexKey, ok, err := entryKey(stub, index, fields)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys[indexKey] = true
+		}
+	}
+	return keys, nil
+}
+
+// decode returns the top level fields of a document value,
+// or nil if there is no value or it belongs to another document type
+func (m *Manager) decode(value []byte) (map[string]json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(value, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if m.docType != "" {
+		var docType string
+		if json.Unmarshal(fields["docType"], &docType) != nil || docType != m.docType {
+			return nil, nil
+		}
+	}
+	return fields, nil
+}
+
+func entryKey(stub shim.ChaincodeStubInterface, index Index, fields map[string]json.RawMessage) (string, bool, error) {
+	attributes := make([]string, 0, len(index.Fields))
+	for _, name := range index.Fields {
+		attribute := fieldString(fields[name])
+		if attribute == "" {
+			return "", false, nil
+		}
+		attributes = append(attributes, attribute)
+	}
+	indexKey, err := stub.CreateCompositeKey(index.Name, attributes)
+	if err != nil {
+		return "", false, err
+	}
+	return indexKey, true, nil
+}
+
+// fieldString renders a JSON field as an index attribute: strings without
+// their quotes, numbers and booleans as written, null and objects as empty
+func fieldString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	text := strings.TrimSpace(string(raw))
+	if text == "null" || strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,202 @@
+package compositeindex
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var testIndexes = NewManager("work",
+	Index{Name: "workstartdate~workId", Fields: []string{"workstartdate", "workId"}},
+	Index{Name: "uid~workId", Fields: []string{"uid", "workId"}},
+)
+
+func newTestStub() *shim.MockStub {
+	stub := shim.NewMockStub("compositeindex", nil)
+	stub.MockTransactionStart("tx1")
+	return stub
+}
+
+func entryKeys(t *testing.T, stub *shim.MockStub, indexName string) []string {
+	iterator, err := stub.GetStateByPartialCompositeKey(indexName, []string{})
+	if err != nil {
+		t.Fatalf("GetStateByPartialCompositeKey %s: %s", indexName, err)
+	}
+	defer iterator.Close()
+	var keys []string
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func compositeKey(t *testing.T, stub *shim.MockStub, indexName string, attributes ...string) string {
+	key, err := stub.CreateCompositeKey(indexName, attributes)
+	if err != nil {
+		t.Fatalf("CreateCompositeKey: %s", err)
+	}
+	return key
+}
+
+func TestPutStateAddsEntries(t *testing.T) {
+	stub := newTestStub()
+	err := testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","uid":"u1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+
+	if string(stub.State["w1"]) == "" {
+		t.Fatalf("document w1 was not written")
+	}
+	byDate := entryKeys(t, stub, "workstartdate~workId")
+	if len(byDate) != 1 || byDate[0] != compositeKey(t, stub, "workstartdate~workId", "20200101000000", "w1") {
+		t.Fatalf("unexpected workstartdate~workId entries %q", byDate)
+	}
+	byUid := entryKeys(t, stub, "uid~workId")
+	if len(byUid) != 1 || byUid[0] != compositeKey(t, stub, "uid~workId", "u1", "w1") {
+		t.Fatalf("unexpected uid~workId entries %q", byUid)
+	}
+}
+
+func TestPutStateMovesChangedEntries(t *testing.T) {
+	stub := newTestStub()
+	err := testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","uid":"u1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	err = testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","uid":"u2","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+
+	byUid := entryKeys(t, stub, "uid~workId")
+	if len(byUid) != 1 || byUid[0] != compositeKey(t, stub, "uid~workId", "u2", "w1") {
+		t.Fatalf("uid~workId entry was not moved, got %q", byUid)
+	}
+	if len(entryKeys(t, stub, "workstartdate~workId")) != 1 {
+		t.Fatalf("unchanged workstartdate~workId entry was duplicated")
+	}
+}
+
+func TestPutStateSkipsMissingFieldsAndOtherDocTypes(t *testing.T) {
+	stub := newTestStub()
+	err := testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	err = testIndexes.PutState(stub, "m1", []byte(`{"docType":"marble","workId":"m1","uid":"u1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+
+	if keys := entryKeys(t, stub, "uid~workId"); len(keys) != 0 {
+		t.Fatalf("work without uid or other doc type indexed by uid: %q", keys)
+	}
+	if keys := entryKeys(t, stub, "workstartdate~workId"); len(keys) != 1 {
+		t.Fatalf("expected only the work in workstartdate~workId, got %q", keys)
+	}
+}
+
+func TestDelStateRemovesEntries(t *testing.T) {
+	stub := newTestStub()
+	err := testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","uid":"u1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	err = testIndexes.DelState(stub, "w1")
+	if err != nil {
+		t.Fatalf("DelState: %s", err)
+	}
+
+	if stub.State["w1"] != nil {
+		t.Fatalf("document w1 was not deleted")
+	}
+	if keys := entryKeys(t, stub, "workstartdate~workId"); len(keys) != 0 {
+		t.Fatalf("workstartdate~workId entries left behind: %q", keys)
+	}
+	if keys := entryKeys(t, stub, "uid~workId"); len(keys) != 0 {
+		t.Fatalf("uid~workId entries left behind: %q", keys)
+	}
+}
+
+func TestEnsureAndHasEntry(t *testing.T) {
+	stub := newTestStub()
+	value := []byte(`{"docType":"work","workId":"w1","uid":"u1","workstartdate":"20200101000000"}`)
+	err := stub.PutState("w1", value)
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	index, _ := testIndexes.Index("uid~workId")
+
+	_, ok, err := testIndexes.HasEntry(stub, index, value)
+	if err != nil || ok {
+		t.Fatalf("HasEntry before EnsureEntry = %v, %v, want false", ok, err)
+	}
+	indexKey, added, err := testIndexes.EnsureEntry(stub, index, value)
+	if err != nil || !added {
+		t.Fatalf("EnsureEntry = %v, %v, want added", added, err)
+	}
+	if indexKey != compositeKey(t, stub, "uid~workId", "u1", "w1") {
+		t.Fatalf("EnsureEntry returned key %q", indexKey)
+	}
+	_, added, err = testIndexes.EnsureEntry(stub, index, value)
+	if err != nil || added {
+		t.Fatalf("second EnsureEntry = %v, %v, want not added", added, err)
+	}
+	_, ok, err = testIndexes.HasEntry(stub, index, value)
+	if err != nil || !ok {
+		t.Fatalf("HasEntry after EnsureEntry = %v, %v, want true", ok, err)
+	}
+}
+
+func TestIsOrphaned(t *testing.T) {
+	stub := newTestStub()
+	err := testIndexes.PutState(stub, "w1", []byte(`{"docType":"work","workId":"w1","uid":"u1","workstartdate":"20200101000000"}`))
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	index, _ := testIndexes.Index("uid~workId")
+
+	current := compositeKey(t, stub, "uid~workId", "u1", "w1")
+	stale := compositeKey(t, stub, "uid~workId", "u0", "w1")
+	missing := compositeKey(t, stub, "uid~workId", "u1", "w2")
+	for _, tc := range []struct {
+		indexKey string
+		orphaned bool
+	}{
+		{current, false},
+		{stale, true},
+		{missing, true},
+	} {
+		orphaned, err := testIndexes.IsOrphaned(stub, index, tc.indexKey)
+		if err != nil {
+			t.Fatalf("IsOrphaned: %s", err)
+		}
+		if orphaned != tc.orphaned {
+			t.Errorf("IsOrphaned(%q) = %v, want %v", tc.indexKey, orphaned, tc.orphaned)
+		}
+	}
+}
+
+func TestFieldString(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{`"u1"`, "u1"},
+		{`20200101`, "20200101"},
+		{`true`, "true"},
+		{`null`, ""},
+		{`{"a":1}`, ""},
+		{`[1]`, ""},
+		{``, ""},
+	} {
+		if got := fieldString([]byte(tc.raw)); got != tc.want {
+			t.Errorf("fieldString(%s) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package identity names the submitter of a transaction the way it is recorded on the ledger.
+//
+// The chaincodes of this repository share one set of strategies, chosen in their
+// Init configuration:
+//
+//	cnRegex        first capture group (or whole match) of a regex on the certificate CN
+//	mspEnrollment  MSP ID plus enrollment ID, e.g. Org1MSP:user1, the default
+//	certAttribute  value of a Fabric CA attribute in the certificate
+//	nodeOU         MSP ID plus NodeOU role, e.g. Org1MSP:client
+package identity
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// Strategies to resolve the name of a caller
+const (
+	StrategyCNRegex       = "cnRegex"
+	StrategyMSPEnrollment = "mspEnrollment"
+	StrategyCertAttribute = "certAttribute"
+	StrategyNodeOU        = "nodeOU"
+)
+
+// DefaultAttribute is the attribute the certAttribute strategy reads unless configured otherwise
+const DefaultAttribute = "hf.EnrollmentID"
+
+// Config chooses the strategy, it is part of the Init configuration of a chaincode
+type Config struct {
+	Strategy  string `json:"identityStrategy"`
+	Pattern   string `json:"identityPattern,omitempty"`   //regex for cnRegex
+	Attribute string `json:"identityAttribute,omitempty"` //attribute name for certAttribute
+}
+
+// Caller is the identity that submitted the transaction
+type Caller struct {
+	MSPID string
+	Cert  *x509.Certificate
+}
+
+// Resolver turns a caller into the name recorded on the ledger
+type Resolver interface {
+	Resolve(caller *Caller) (string, error)
+}
+
+type cnRegexResolver struct {
+	pattern *regexp.Regexp
+}
+
+type mspEnrollmentResolver struct {
+}
+
+type certAttributeResolver struct {
+	attribute string
+}
+
+type nodeOUResolver struct {
+}
+
+// Fabric CA stores certificate attributes as JSON under this extension
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// NodeOU roles an MSP can classify identities with
+var nodeOURoles = []string{"client", "peer", "admin", "orderer"}
+
+// NewResolver builds the resolver chosen by config
+func NewResolver(config Config) (Resolver, error) {
+	switch config.Strategy {
+	case StrategyCNRegex:
+		if config.Pattern == "" {
+			return nil, fmt.Errorf("identityPattern is required for the %s strategy", StrategyCNRegex)
+		}
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid identityPattern: %s", err)
+		}
+		return &cnRegexResolver{pattern: pattern}, nil
+	case StrategyMSPEnrollment, "":
+		return &mspEnrollmentResolver{}, nil
+	case StrategyCertAttribute:
+		attribute := config.Attribute
+		if attribute == "" {
+			attribute = DefaultAttribute
+		}
+		return &certAttributeResolver{attribute: attribute}, nil
+	case StrategyNodeOU:
+		return &nodeOUResolver{}, nil
+	}
+	return nil, fmt.Errorf("Unknown identityStrategy %s", config.Strategy)
+}
+
+// GetCaller reads the MSP ID and the x509 certificate of the submitter from the signed proposal
+func GetCaller(stub shim.ChaincodeStubInterface) (*Caller, error) {
+	creatorBytes, err := stub.GetCreator()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get creator: %s", err)
+	}
+
+	serializedId := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(creatorBytes, serializedId)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal creator identity: %s", err)
+	}
+
+	block, _ := pem.Decode(serializedId.IdBytes)
+	if block == nil {
+		return nil, fmt.Errorf("Could not decode the PEM certificate of %s creator", serializedId.Mspid)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse certificate of %s creator: %s", serializedId.Mspid, err)
+	}
+
+	return &Caller{MSPID: serializedId.Mspid, Cert: cert}, nil
+}
+
+// ResolveCaller reads the submitter of the transaction and names it with the resolver chosen by config
+func ResolveCaller(stub shim.ChaincodeStubInterface, config Config) (*Caller, string, error) {
+	caller, err := GetCaller(stub)
+	if err != nil {
+		return nil, "", err
+	}
+	resolver, err := NewResolver(config)
+	if err != nil {
+		return nil, "", err
+	}
+	name, err := resolver.Resolve(caller)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to resolve caller name: %s", err)
+	}
+	return caller, name, nil
+}
+
+func (r *cnRegexResolver) Resolve(caller *Caller) (string, error) {
+	commonName := caller.Cert.Subject.CommonName
+	match := r.pattern.FindStringSubmatch(commonName)
+	if match == nil {
+		return "", fmt.Errorf("CN %s of %s caller does not match %s", commonName, caller.MSPID, r.pattern)
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+func (r *mspEnrollmentResolver) Resolve(caller *Caller) (string, error) {
+	attributes, err := CertAttributes(caller.Cert)
+	if err != nil {
+		return "", err
+	}
+	// certificates issued outside Fabric CA carry the enrollment ID only as CN
+	enrollmentId, ok := attributes["hf.EnrollmentID"]
+	if !ok {
+		enrollmentId = caller.Cert.Subject.CommonName
+	}
+	if enrollmentId == "" {
+		return "", fmt.Errorf("%s caller has no enrollment ID", caller.MSPID)
+	}
+	return caller.MSPID + ":" + enrollmentId, nil
+}
+
+func (r *certAttributeResolver) Resolve(caller *Caller) (string, error) {
+	attributes, err := CertAttributes(caller.Cert)
+	if err != nil {
+		return "", err
+	}
+	value, ok := attributes[r.attribute]
+	if !ok || value == "" {
+		return "", fmt.Errorf("%s caller certificate has no attribute %s", caller.MSPID, r.attribute)
+	}
+	return value, nil
+}
+
+func (r *nodeOUResolver) Resolve(caller *Caller) (string, error) {
+	for _, unit := range caller.Cert.Subject.OrganizationalUnit {
+		for _, role := range nodeOURoles {
+			if unit == role {
+				return caller.MSPID + ":" + role, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s caller certificate has no NodeOU role", caller.MSPID)
+}
+
+// CertAttributes returns the Fabric CA attributes of a certificate
+func CertAttributes(cert *x509.Certificate) (map[string]string, error) {
+	attributes := struct {
+		Attrs map[string]string `json:"attrs"`
+	}{}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(attributesOID) {
+			continue
+		}
+		err := json.Unmarshal(ext.Value, &attributes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode certificate attributes: %s", err)
+		}
+	}
+	if attributes.Attrs == nil {
+		return map[string]string{}, nil
+	}
+	return attributes.Attrs, nil
+}
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// newCertificate returns a self-signed certificate, PEM encoded, with the given
+// subject and Fabric CA attributes
+func newCertificate(t *testing.T, subject pkix.Name, attrs string) (*x509.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if attrs != "" {
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: []byte(attrs)}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %s", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestResolvers(t *testing.T) {
+	cert, _ := newCertificate(t, pkix.Name{CommonName: "alice@org1.example.com", OrganizationalUnit: []string{"department1", "client"}},
+		`{"attrs":{"hf.EnrollmentID":"alice","employeeId":"e42"}}`)
+	plain, _ := newCertificate(t, pkix.Name{CommonName: "bob"}, "")
+	for _, tc := range []struct {
+		config Config
+		cert   *x509.Certificate
+		want   string
+		fails  bool
+	}{
+		{Config{}, cert, "Org1MSP:alice", false},
+		{Config{Strategy: StrategyMSPEnrollment}, plain, "Org1MSP:bob", false},
+		{Config{Strategy: StrategyCNRegex, Pattern: "^([^@]+)@"}, cert, "alice", false},
+		{Config{Strategy: StrategyCNRegex, Pattern: "^([^@]+)@"}, plain, "", true},
+		{Config{Strategy: StrategyCNRegex, Pattern: "org1"}, cert, "org1", false},
+		{Config{Strategy: StrategyCertAttribute}, cert, "alice", false},
+		{Config{Strategy: StrategyCertAttribute, Attribute: "employeeId"}, cert, "e42", false},
+		{Config{Strategy: StrategyCertAttribute}, plain, "", true},
+		{Config{Strategy: StrategyNodeOU}, cert, "Org1MSP:client", false},
+		{Config{Strategy: StrategyNodeOU}, plain, "", true},
+	} {
+		resolver, err := NewResolver(tc.config)
+		if err != nil {
+			t.Fatalf("NewResolver(%+v): %s", tc.config, err)
+		}
+		name, err := resolver.Resolve(&Caller{MSPID: "Org1MSP", Cert: tc.cert})
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%+v resolved %s as %q, want an error", tc.config, tc.cert.Subject.CommonName, name)
+			}
+			continue
+		}
+		if err != nil || name != tc.want {
+			t.Errorf("%+v resolved %s as %q, %v, want %q", tc.config, tc.cert.Subject.CommonName, name, err, tc.want)
+		}
+	}
+}
+
+func TestNewResolverRejectsInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{Strategy: StrategyCNRegex},
+		{Strategy: StrategyCNRegex, Pattern: "("},
+		{Strategy: "email"},
+	} {
+		if _, err := NewResolver(config); err == nil {
+			t.Errorf("NewResolver(%+v) accepted, want an error", config)
+		}
+	}
+}
+
+func TestResolveCaller(t *testing.T) {
+	_, certPEM := newCertificate(t, pkix.Name{CommonName: "alice"}, `{"attrs":{"hf.EnrollmentID":"alice"}}`)
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org2MSP", IdBytes: certPEM})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	stub := shim.NewMockStub("identity", nil)
+	stub.Creator = creator
+
+	caller, name, err := ResolveCaller(stub, Config{})
+	if err != nil {
+		t.Fatalf("ResolveCaller: %s", err)
+	}
+	if caller.MSPID != "Org2MSP" || name != "Org2MSP:alice" {
+		t.Errorf("ResolveCaller = %s, %q, want Org2MSP and Org2MSP:alice", caller.MSPID, name)
+	}
+}
@@ -2,21 +2,62 @@
 // ====CHAINCODE EXECUTION SAMPLES (CLI) ==================
 
 // ==== Invoke works ====
-// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work1","blue","35","tom"]}'
-// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work2","red","50","tom"]}'
-// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work3","blue","70","tom"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work1","20150301090000","20180630180000","tom","c4ca4238a0b923820dcc509a6f75849b","Org2MSP"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work2","2018-07-02","2019-05-31T18:00:00+08:00","tom","c4ca4238a0b923820dcc509a6f75849b","Org2MSP"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWork","work3","20150301090000","20170131180000","tom","c81e728d9d4c2f636f067f89cc14862c","Org3MSP"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWorksBatch","[{\"workId\":\"work5\",\"workstartdate\":\"2019-06-03\",\"workenddate\":20200131180000,\"workexperience\":\"tom\",\"candidateUid\":\"c4ca4238a0b923820dcc509a6f75849b\",\"employer\":\"Org2MSP\"}]","true"]}'
+// export WORK=$(echo -n "{\"workId\":\"work4\",\"candidateUid\":\"c4ca4238a0b923820dcc509a6f75849b\",\"workstartdate\":\"20120901090000\",\"workenddate\":20150228180000,\"workexperience\":\"tom\",\"employer\":\"Org2MSP\",\"salt\":\"9f86d081884c7d659a2feaa0c55ad015\"}" | base64 | tr -d \\n)
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["initWorkPrivate"]}' --transient "{\"work\":\"$WORK\"}"
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["attestWork","work1"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["rejectWork","work3","employment dates do not match payroll"]}'
 // peer chaincode invoke -C myc1 -n works -c '{"Args":["transferWork","work2","jerry"]}'
-// peer chaincode invoke -C myc1 -n works -c '{"Args":["transferWorksBasedOnWorkstartdate","blue","jerry"]}'
-// peer chaincode invoke -C myc1 -n works -c '{"Args":["delete","work1"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["transferWorksBasedOnWorkstartdate","20150301090000","jerry"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["delete","work1","ENTERED_IN_ERROR"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["purgeWork","work1"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["rebuildIndexes","workstartdate~workId",""]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["migrateWorks","","100"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["migrateWorks","","100","Org2MSP"]}' --peerAddresses peer0.org1.example.com:7051 --peerAddresses peer0.org2.example.com:9051
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["setWorkEndorsementPolicy","work1","Org2MSP,Org3MSP"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["readWorkAudited","work1","RECRUITMENT"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["grantAccess","c4ca4238a0b923820dcc509a6f75849b","Org4MSP","works","2019-12-31T00:00:00Z"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["revokeAccess","c4ca4238a0b923820dcc509a6f75849b","Org4MSP","works"]}'
+// peer chaincode invoke -C myc1 -n works -c '{"Args":["updateConfig","{\"adminMSPs\":[\"Org1MSP\"],\"employerMSPs\":[\"Org2MSP\",\"Org3MSP\"],\"maxWorksBatchSize\":200,\"features\":{\"privateWorks\":false}}"]}'
+
+// Works filed with initWorkPrivate need the collection definition at instantiation:
+// peer chaincode instantiate -C myc1 -n works -v 1.0 -c '{"Args":["init"]}' --collections-config collections_config.json
 
 // ==== Query works ====
 // peer chaincode query -C myc1 -n works -c '{"Args":["readWork","work1"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["readWork","work2","true"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["readWorkPrivate","work4"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["verifyWorkDisclosure","work4","{\"workId\":\"work4\",\"candidateUid\":\"c4ca4238a0b923820dcc509a6f75849b\",\"workstartdate\":\"20120901090000\",\"workenddate\":20150228180000,\"workexperience\":\"tom\",\"employer\":\"Org2MSP\"}","9f86d081884c7d659a2feaa0c55ad015"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["verifyWorkDisclosure","work1","{\"workId\":\"work1\",\"candidateUid\":\"c4ca4238a0b923820dcc509a6f75849b\",\"workstartdate\":\"2015-03-01T09:00:00Z\",\"workenddate\":20180630180000,\"workexperience\":\"tom\",\"employer\":\"Org2MSP\"}",""]}'
 // peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByRange","work1","work3"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByRange","work1","work3","true"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByRangeWithPagination","work1","work9","3",""]}'
 // peer chaincode query -C myc1 -n works -c '{"Args":["getHistoryForWork","work1"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getHistoryForWork","work1","diff","2019-01-01T00:00:00Z","","workexperience,status"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorkAsOf","work1","2019-05-30T12:00:00Z"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["verifyIndexes","workstartdate~workId",""]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorkMigration"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorkMigration","Org2MSP"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorkEndorsementPolicy","work1"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getAccessLogForUid","c4ca4238a0b923820dcc509a6f75849b"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["exportWorkCredential","c4ca4238a0b923820dcc509a6f75849b","work1"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByUid","c4ca4238a0b923820dcc509a6f75849b"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByUid","c4ca4238a0b923820dcc509a6f75849b","Org2MSP","true"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getWorksByEmployer","Org2MSP"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getTimelineForUid","c4ca4238a0b923820dcc509a6f75849b"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getConflictsForUid","c4ca4238a0b923820dcc509a6f75849b"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getConfig"]}'
+// peer chaincode query -C myc1 -n works -c '{"Args":["getConfigHistory"]}'
 
 // Rich Query (Only supported if CouchDB is used as state database):
 //   peer chaincode query -C myc1 -n works -c '{"Args":["queryWorksByWorkexperience","tom"]}'
 //   peer chaincode query -C myc1 -n works -c '{"Args":["queryWorks","{\"selector\":{\"workexperience\":\"tom\"}}"]}'
+//   peer chaincode query -C myc1 -n works -c '{"Args":["queryWorks","{\"selector\":{\"status\":\"revoked\"}}","true"]}'
+//   peer chaincode query -C myc1 -n works -c '{"Args":["queryWorksByWorkexperienceWithPagination","tom","3",""]}'
+//   peer chaincode query -C myc1 -n works -c '{"Args":["queryWorksWithPagination","{\"selector\":{\"employer\":\"Org2MSP\"}}","3",""]}'
 
 //The following examples demonstrate creating indexes on CouchDB
 //Example hostuid:port configurations
@@ -58,28 +99,412 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/tangsk/newchaincode/identity"
+	"github.com/tangsk/newchaincode/workcredential"
+	"github.com/tangsk/newchaincode/workdate"
+	"github.com/tangsk/newchaincode/workrecord"
 )
 
 // SimpleChaincode example simple Chaincode implementation
 type SimpleChaincode struct {
 }
 
-type work struct {
-	ObjectType string `json:"docType"` //docType is used to distinguish the various types of objects in state database
-	Uid       string `json:"uid"`    //the fieldtags are needed to keep case from bouncing around
-	Workstartdate      string `json:"workstartdate"`
-	Workenddate       int    `json:"workenddate"`
-	Workexperience      string `json:"workexperience"`
+// work is the public record of a work, see the workrecord package for its layouts
+type work = workrecord.Work
+
+// Current layout of work documents, see workrecord.Decode
+const workSchemaVersion = workrecord.SchemaVersion
+
+// migrationProgress is stored in state and advanced by every migrateWorks call
+
+type migrationProgress struct {
+	SchemaVersion int      `json:"schemaVersion"` //version the works are migrated to
+	Bookmark      string   `json:"bookmark"`      //key of the last work scanned, empty before the first and after the last page
+	Done          bool     `json:"done"`
+	Scanned       int      `json:"scanned"`        //works scanned over all pages
+	Migrated      int      `json:"migrated"`       //works rewritten over all pages
+	TxId          string   `json:"txId"`           //last transaction that advanced the migration
+	Orgs          []string `json:"orgs,omitempty"` //endorsing orgs of the pass, see migrateWorks
+}
+
+// migrationResult is the response of one migrateWorks call
+type migrationResult struct {
+	Scanned  int                     `json:"scanned"`
+	Migrated []string                `json:"migrated"`
+	Failed   []migrationError        `json:"failed"`  //works that could not be read, they are left as they are
+	Skipped  []workEndorsementPolicy `json:"skipped"` //works bound to orgs that do not endorse this pass
+	Progress migrationProgress       `json:"progress"`
+}
+
+type migrationError struct {
+	WorkId string `json:"workId"`
+	Error  string `json:"error"`
+}
+
+const migrationIndex = "migration"
+
+// workPrivateDetails is the full record stored in collectionWorkPrivateDetails
+type workPrivateDetails struct {
+	ObjectType     string `json:"docType"`
+	WorkId         string `json:"workId"`
+	CandidateUid   string `json:"candidateUid"`
+	Workstartdate  string `json:"workstartdate"`
+	Workenddate    int    `json:"workenddate"`
+	Workexperience string `json:"workexperience"`
+	Employer       string `json:"employer"`
+	Salt           string `json:"salt"`
+}
+
+// disclosureResult tells a verifier whether a work disclosed off-chain
+// matches the ledger, and which fields differ if it does not
+type disclosureResult struct {
+	WorkId     string          `json:"workId"`
+	Match      bool            `json:"match"`
+	ComparedTo string          `json:"comparedTo"` //publicHash for private works, publicRecord otherwise
+	Status     string          `json:"status"`     //attestation status of the work on the ledger
+	Mismatches []fieldMismatch `json:"mismatches"`
+}
+
+type fieldMismatch struct {
+	Field     string `json:"field"`
+	Disclosed string `json:"disclosed"`
+	Reason    string `json:"reason"`
+}
+
+// Chaincode events emitted on every work lifecycle change. The event name is the
+// event type, the payload is a workEvent. Fabric delivers only the last event set
+// in a transaction, so functions changing several works emit one event listing them.
+const (
+	eventWorkCreated     = "WorkCreated"
+	eventWorkTransferred = "WorkTransferred"
+	eventWorkDeleted     = "WorkDeleted"
+	eventWorkAttested    = "WorkAttested"
+	eventWorkRejected    = "WorkRejected"
+	eventWorkRevoked     = "WorkRevoked"
+)
+
+type workEvent struct {
+	Type          string   `json:"type"`
+	WorkId        string   `json:"workId,omitempty"`
+	WorkIds       []string `json:"workIds,omitempty"` //set instead of workId when several works changed
+	Uid           string   `json:"uid,omitempty"`
+	Actor         string   `json:"actor"`
+	TxId          string   `json:"txId"`
+	ChangedFields []string `json:"changedFields"`
+}
+
+// workHistoryDiff lists the fields one transaction changed on a work
+type workHistoryDiff struct {
+	TxId      string        `json:"txId"`
+	Timestamp string        `json:"timestamp"`
+	IsDelete  bool          `json:"isDelete"`
+	Changes   []fieldChange `json:"changes"`
+}
+
+// fieldChange is a field changed by a version, see workrecord.DiffFields
+type fieldChange = workrecord.FieldChange
+
+// workVersion is the value a work had at a point in time
+type workVersion struct {
+	WorkId    string          `json:"workId"`
+	AsOf      string          `json:"asOf"`
+	Exists    bool            `json:"exists"`   //false if the work was never written before asOf
+	IsDelete  bool            `json:"isDelete"` //true if the work was deleted at asOf
+	TxId      string          `json:"txId,omitempty"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// workIndexes declares the composite key indexes of works, see workrecord.Indexes
+var workIndexes = workrecord.Indexes
+
+const (
+	startIndex       = workrecord.StartIndex
+	uidStartIndex    = workrecord.UidStartIndex
+	uidEmployerIndex = workrecord.UidEmployerIndex
+	employerUidIndex = workrecord.EmployerUidIndex
+)
+
+// workEndorsementPolicy lists the orgs whose peers must endorse changes to a work
+type workEndorsementPolicy struct {
+	WorkId string   `json:"workId"`
+	Orgs   []string `json:"orgs"` //empty if only the chaincode endorsement policy applies
+}
+
+// workConflict is a pair of works of one uid with overlapping periods
+type workConflict struct {
+	WorkId       string `json:"workId"`
+	OtherWorkId  string `json:"otherWorkId"`
+	OverlapStart string `json:"overlapStart"` //yyyyMMddHHmmss UTC
+	OverlapEnd   string `json:"overlapEnd"`
+	Flagged      bool   `json:"flagged"` //the later filed work was marked conflicting under the flag policy
+}
+
+// workBatchItem is one work in the initWorksBatch argument
+type workBatchItem struct {
+	WorkId         string    `json:"workId"`
+	Workstartdate  batchDate `json:"workstartdate"`
+	Workenddate    batchDate `json:"workenddate"`
+	Workexperience string    `json:"workexperience"`
+	CandidateUid   string    `json:"candidateUid"`
+	Employer       string    `json:"employer"`
+}
+
+// batchDate takes a date written either as a JSON string or as a yyyyMMddHHmmss number
+type batchDate string
+
+func (d *batchDate) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*d = batchDate(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("dates must be strings or numbers")
+	}
+	*d = batchDate(n.String())
+	return nil
+}
+
+// Result states of the items of a batch
+const (
+	workBatchCreated = "created"
+	workBatchInvalid = "invalid"
+	workBatchSkipped = "skipped" //valid, but not created because other items were invalid
+)
+
+type workBatchResult struct {
+	Index  int    `json:"index"` //position of the item in the batch
+	WorkId string `json:"workId"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type workBatchResponse struct {
+	Created int               `json:"created"`
+	Invalid int               `json:"invalid"`
+	Results []workBatchResult `json:"results"`
+}
+
+// Number of works or index entries rebuildIndexes and verifyIndexes handle per call,
+// small enough for one transaction
+const indexScanChunkSize = 100
+
+// verifyIndexes scans the works first and the index entries second,
+// its bookmark tells which of the two it is in
+const (
+	indexPhaseRecords = "records:"
+	indexPhaseEntries = "entries:"
+)
+
+// indexRebuildResult is one chunk of rebuildIndexes
+type indexRebuildResult struct {
+	IndexName    string       `json:"indexName"`
+	WorksScanned int          `json:"worksScanned"`
+	Added        []indexEntry `json:"added"`
+	Bookmark     string       `json:"bookmark"` //pass to the next call, empty once all works were scanned
+}
+
+// indexVerifyResult is one chunk of verifyIndexes
+type indexVerifyResult struct {
+	IndexName string       `json:"indexName"`
+	Scanned   int          `json:"scanned"`  //works or index entries looked at in this chunk
+	Missing   []indexEntry `json:"missing"`  //works without their index entry
+	Orphaned  []indexEntry `json:"orphaned"` //index entries without a matching work
+	Bookmark  string       `json:"bookmark"` //pass to the next call, empty once done
+}
+
+type indexEntry struct {
+	WorkId     string   `json:"workId"`
+	Attributes []string `json:"attributes"`
+}
+
+// Private data collection shared by the employer and candidate orgs, see collections_config.json
+const collectionWorkPrivateDetails = "collectionWorkPrivateDetails"
+
+// A salt shorter than this would let anyone brute force the hashed fields
+const minSaltLength = 16
+
+// Attestation states of a work record. A candidate files a claim as pending,
+// the employer org named on the record moves it to verified or rejected.
+// A revoked work stays on the ledger but is hidden from queries by default.
+const (
+	statusPending  = workrecord.StatusPending
+	statusVerified = workrecord.StatusVerified
+	statusRejected = workrecord.StatusRejected
+	statusRevoked  = workrecord.StatusRevoked
+)
+
+// Reasons a work can be revoked for
+var revocationReasons = []string{
+	"ENTERED_IN_ERROR",
+	"FRAUDULENT",
+	"DUPLICATE",
+	"EMPLOYER_REQUEST",
+	"CANDIDATE_REQUEST",
+}
+
+// Purposes a third party reads a work for with readWorkAudited
+var accessPurposes = []string{
+	"RECRUITMENT",
+	"BACKGROUND_CHECK",
+	"CANDIDATE_REQUEST",
+	"LEGAL_OBLIGATION",
+	"AUDIT",
+}
+
+// Roles an organization can play on the channel
+const (
+	roleEmployer  = "employer"
+	roleCandidate = "candidate"
+	roleRecruiter = "recruiter"
+	roleAdmin     = "admin"
+)
+
+// orgRoles maps the MSP ID of each member organization to the roles it plays.
+// Callers from an MSP that is not listed here are not authorized to write state.
+var orgRoles = map[string][]string{
+	"Org1MSP": {roleCandidate, roleAdmin},
+	"Org2MSP": {roleEmployer},
+	"Org3MSP": {roleEmployer},
+	"Org4MSP": {roleRecruiter},
+}
+
+// accessGrant lets a grantee org read the works of a uid until it expires.
+// Grants are kept under the composite key grant~uid~granteeMSP~scope.
+type accessGrant struct {
+	ObjectType string `json:"docType"`
+	Uid        string `json:"uid"`
+	GranteeMSP string `json:"granteeMSP"`
+	Scope      string `json:"scope"`     //works, history or all
+	ExpiresAt  string `json:"expiresAt"` //RFC3339, compared with the tx timestamp
+	GrantedBy  string `json:"grantedBy"`
+	TxId       string `json:"txId"`
+}
+
+const grantIndex = "grant"
+
+// dataSubject binds a uid to the person its works belong to, named by the configured
+// identity resolver. The first work filed for a uid binds it to the claimant. From then
+// on only that identity may file works of the uid, grant or revoke access to them and
+// read them without a grant. Subjects are kept under the composite key subject~uid.
+type dataSubject struct {
+	ObjectType string `json:"docType"`
+	Uid        string `json:"uid"`
+	Subject    string `json:"subject"` //resolved name of the identity the uid belongs to
+	TxId       string `json:"txId"`
+}
+
+const subjectIndex = "subject"
+
+// accessLogEntry records one audited read of a work.
+// Entries are kept under the composite key access~uid~txid.
+type accessLogEntry struct {
+	ObjectType string `json:"docType"`
+	Uid        string `json:"uid"`
+	WorkId     string `json:"workId"`
+	CallerMSP  string `json:"callerMSP"`
+	Caller     string `json:"caller"`  //resolved name of the reading identity
+	Purpose    string `json:"purpose"` //one of the access purpose codes
+	TxId       string `json:"txId"`
+	Timestamp  string `json:"timestamp"` //tx timestamp set by the client, RFC3339
+}
+
+const accessLogIndex = "access"
+
+// Scopes of access grants
+const (
+	scopeWorks   = "works"   //readWork, range, index and rich queries
+	scopeHistory = "history" //getHistoryForWork and getWorkAsOf
+	scopeAll     = "all"
+)
+
+var accessScopes = []string{scopeWorks, scopeHistory, scopeAll}
+
+// accessChecker decides which works the caller of a transaction may read.
+// The data subject of a uid and the employer named on a work read it freely.
+// Everyone else, members of candidate and admin orgs included, needs a grant
+// of the uid for the scope that has not expired at the transaction time.
+// Subjects and grants are looked up once per uid and scope.
+type accessChecker struct {
+	stub     shim.ChaincodeStubInterface
+	caller   *identity.Caller
+	name     string //resolved name of the caller
+	admin    bool   //the caller's org plays the admin role
+	now      time.Time
+	subjects map[string]string
+	granted  map[string]bool
+}
+
+// contractConfig is the configuration passed to Init or updateConfig and kept in state.
+// Fields left out fall back to the defaults below.
+type contractConfig struct {
+	IdentityStrategy      string          `json:"identityStrategy"`                //one of the identity package strategies
+	IdentityPattern       string          `json:"identityPattern,omitempty"`       //regex for cnRegex
+	IdentityAttribute     string          `json:"identityAttribute,omitempty"`     //attribute name for certAttribute
+	AdminMSPs             []string        `json:"adminMSPs,omitempty"`             //replace the admin orgs of orgRoles
+	EmployerMSPs          []string        `json:"employerMSPs,omitempty"`          //replace the employer orgs of orgRoles
+	DateFormat            string          `json:"dateFormat,omitempty"`            //Go layout of work dates
+	Timezone              string          `json:"timezone,omitempty"`              //UTC or a fixed offset like +08:00 of dates without a zone
+	MaxWorksBatchSize     int             `json:"maxWorksBatchSize,omitempty"`     //largest initWorksBatch
+	MaxMigrationBatchSize int             `json:"maxMigrationBatchSize,omitempty"` //largest migrateWorks page
+	Features              map[string]bool `json:"features,omitempty"`              //feature toggles, all on unless set false
+	OverlapPolicy         string          `json:"overlapPolicy,omitempty"`         //reject or flag works overlapping others of the uid
+	//set when the configuration is stored
+	Version   int    `json:"version"`
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	TxId      string `json:"txId,omitempty"`
 }
 
+// Defaults for the optional configuration fields
+const (
+	defaultDateFormat            = workdate.Layout //yyyyMMddHHmmss
+	defaultMaxWorksBatchSize     = 500
+	defaultMaxMigrationBatchSize = 500
+)
+
+// No configuration may allow batches larger than this, they would not fit in a transaction
+const batchSizeLimit = 2000
+
+// Feature toggles of the configuration
+const (
+	featurePrivateWorks = "privateWorks" //initWorkPrivate
+	featureBatchImport  = "batchImport"  //initWorksBatch
+	featureTransfers    = "transfers"    //transferWork and transferWorksBasedOnWorkstartdate
+	featureKeyPolicies  = "keyPolicies"  //key-level endorsement policies set on review
+)
+
+var knownFeatures = []string{featurePrivateWorks, featureBatchImport, featureTransfers, featureKeyPolicies}
+
+// Overlap policies of the configuration, for works of one uid claiming overlapping periods
+const (
+	overlapReject = "reject" //refuse the work, the default
+	overlapFlag   = "flag"   //keep the work, it is marked conflicting with the works it overlaps
+)
+
+// The configuration lives under the composite key config~contract, so it
+// never collides with a workId and is skipped by getWorksByRange.
+// Every version is also kept under configHistory~version.
+const (
+	configIndex        = "config"
+	configHistoryIndex = "configHistory"
+)
+
+const eventConfigUpdated = "ConfigUpdated"
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -92,10 +517,141 @@ func main() {
 
 // Init initializes chaincode
 // ===========================
+// Init accepts an optional JSON configuration, e.g.
+// {"identityStrategy":"cnRegex","identityPattern":"^([^@]+)@","adminMSPs":["Org1MSP"],
+//  "employerMSPs":["Org2MSP","Org3MSP"],"dateFormat":"20060102150405","timezone":"+08:00",
+//  "maxWorksBatchSize":500,"maxMigrationBatchSize":500,"features":{"privateWorks":false},"overlapPolicy":"flag"}
+// Without one, the defaults apply and callers are named by MSP ID plus enrollment ID.
+// On upgrade without arguments the stored configuration is kept. Once a configuration is
+// stored, only admins may replace it through Init, as with updateConfig.
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	// an upgrade by any org must not rewrite the roles and policies of the contract
+	configured, err := hasContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if configured {
+		_, err = authorize(stub, roleAdmin)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	config, err := parseContractConfig(args[0])
+	if err != nil {
+		// fail the deployment rather than every later transaction
+		return shim.Error(err.Error())
+	}
+	err = putContractConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
+// ===========================================================
+// updateConfig replaces the contract configuration.
+// The new document is validated like the one passed to Init,
+// the previous versions stay available through getConfigHistory.
+// Only admins may update the configuration.
+// ===========================================================
+func (t *SimpleChaincode) updateConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "{...}"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	_, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := parseContractConfig(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putContractConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetEvent(eventConfigUpdated, configJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(configJSONasBytes)
+}
+
+// ===========================================================
+// getConfig returns the contract configuration in effect
+// ===========================================================
+func (t *SimpleChaincode) getConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(configJSONasBytes)
+}
+
+// ===========================================================
+// getConfigHistory returns every stored version of the
+// contract configuration, oldest first
+// ===========================================================
+func (t *SimpleChaincode) getConfigHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(configHistoryIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing the configuration versions
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
 // Invoke - Our entry point for Invocations
 // ========================================
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
@@ -105,22 +661,80 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	// Handle different functions
 	if function == "initWork" { //create a new work
 		return t.initWork(stub, args)
+	} else if function == "initWorksBatch" { //create many works in one transaction
+		return t.initWorksBatch(stub, args)
 	} else if function == "transferWork" { //change workexperience of a specific work
 		return t.transferWork(stub, args)
 	} else if function == "transferWorksBasedOnWorkstartdate" { //transfer all works of a certain workstartdate
 		return t.transferWorksBasedOnWorkstartdate(stub, args)
-	} else if function == "delete" { //delete a work
+	} else if function == "delete" { //revoke a work
 		return t.delete(stub, args)
+	} else if function == "purgeWork" { //remove a work from state for good
+		return t.purgeWork(stub, args)
+	} else if function == "initWorkPrivate" { //create a new work with private details
+		return t.initWorkPrivate(stub, args)
+	} else if function == "readWorkPrivate" { //read the private details of a work
+		return t.readWorkPrivate(stub, args)
+	} else if function == "attestWork" { //employer confirms a pending work
+		return t.attestWork(stub, args)
+	} else if function == "rejectWork" { //employer rejects a pending work
+		return t.rejectWork(stub, args)
 	} else if function == "readWork" { //read a work
 		return t.readWork(stub, args)
+	} else if function == "verifyWorkDisclosure" { //check an off-chain copy of a work against the ledger
+		return t.verifyWorkDisclosure(stub, args)
 	} else if function == "queryWorksByWorkexperience" { //find works for workexperience X using rich query
 		return t.queryWorksByWorkexperience(stub, args)
 	} else if function == "queryWorks" { //find works based on an ad hoc rich query
 		return t.queryWorks(stub, args)
+	} else if function == "queryWorksByWorkexperienceWithPagination" { //find works for workexperience X one page at a time
+		return t.queryWorksByWorkexperienceWithPagination(stub, args)
+	} else if function == "queryWorksWithPagination" { //find works based on an ad hoc rich query one page at a time
+		return t.queryWorksWithPagination(stub, args)
 	} else if function == "getHistoryForWork" { //get history of values for a work
 		return t.getHistoryForWork(stub, args)
+	} else if function == "getWorkAsOf" { //get the value a work had at a point in time
+		return t.getWorkAsOf(stub, args)
 	} else if function == "getWorksByRange" { //get works based on range query
 		return t.getWorksByRange(stub, args)
+	} else if function == "getWorksByRangeWithPagination" { //get works one page at a time
+		return t.getWorksByRangeWithPagination(stub, args)
+	} else if function == "rebuildIndexes" { //add missing index entries, one chunk of works at a time
+		return t.rebuildIndexes(stub, args)
+	} else if function == "verifyIndexes" { //report missing and orphaned index entries, one chunk at a time
+		return t.verifyIndexes(stub, args)
+	} else if function == "getWorkEndorsementPolicy" { //get the orgs that must endorse changes to a work
+		return t.getWorkEndorsementPolicy(stub, args)
+	} else if function == "setWorkEndorsementPolicy" { //change the orgs that must endorse changes to a work
+		return t.setWorkEndorsementPolicy(stub, args)
+	} else if function == "readWorkAudited" { //read a work and record the access
+		return t.readWorkAudited(stub, args)
+	} else if function == "getAccessLogForUid" { //get the audited reads of the works of a uid
+		return t.getAccessLogForUid(stub, args)
+	} else if function == "grantAccess" { //let an org read the works of a uid for a while
+		return t.grantAccess(stub, args)
+	} else if function == "revokeAccess" { //withdraw an access grant
+		return t.revokeAccess(stub, args)
+	} else if function == "exportWorkCredential" { //export an attested work as a verifiable credential
+		return t.exportWorkCredential(stub, args)
+	} else if function == "getWorksByUid" { //get the works of a uid, optionally of one employer
+		return t.getWorksByUid(stub, args)
+	} else if function == "getWorksByEmployer" { //get the works of an employer, optionally of one uid
+		return t.getWorksByEmployer(stub, args)
+	} else if function == "getTimelineForUid" { //get the employment timeline of a uid
+		return t.getTimelineForUid(stub, args)
+	} else if function == "getConflictsForUid" { //get the works of a uid with overlapping periods
+		return t.getConflictsForUid(stub, args)
+	} else if function == "updateConfig" { //replace the contract configuration
+		return t.updateConfig(stub, args)
+	} else if function == "getConfig" { //get the contract configuration
+		return t.getConfig(stub, args)
+	} else if function == "getConfigHistory" { //get every version of the contract configuration
+		return t.getConfigHistory(stub, args)
+	} else if function == "migrateWorks" { //rewrite works in old layouts in the current one, one page at a time
+		return t.migrateWorks(stub, args)
+	} else if function == "getWorkMigration" { //get the progress of migrateWorks
+		return t.getWorkMigration(stub, args)
 	}
 
 	fmt.Println("invoke did not find func: " + function) //error
@@ -133,10 +747,20 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 func (t *SimpleChaincode) initWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 
-	//   0       1       2     3
-	// "asdf", "blue", "35", "bob"
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	//   0       1                 2                 3      4      5
+	// "asdf", "20150301090000", "20180630180000", "bob", "uid", "Org2MSP"
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 6")
+	}
+
+	// ==== Only candidate orgs may file a work ====
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimant, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	// ==== Input sanitation ====
@@ -153,231 +777,2690 @@ func (t *SimpleChaincode) initWork(stub shim.ChaincodeStubInterface, args []stri
 	if len(args[3]) <= 0 {
 		return shim.Error("4th argument must be a non-empty string")
 	}
-	workUid := args[0]
-	workstartdate := strings.ToLower(args[1])
-	workexperience := strings.ToLower(args[3])
-	workenddate, err := strconv.Atoi(args[2])
+	if len(args[4]) <= 0 {
+		return shim.Error("5th argument must be a non-empty string")
+	}
+	if len(args[5]) <= 0 {
+		return shim.Error("6th argument must be a non-empty string")
+	}
+	workId := args[0]
+
+	config, err := getContractConfig(stub)
 	if err != nil {
-		return shim.Error("3rd argument must be a numeric string")
+		return shim.Error(err.Error())
 	}
 
-	// ==== Check if work already exists ====
-	workAsBytes, err := stub.GetState(workUid)
+	// ==== Check if work already exists and create work object ====
+	work, err := newWork(stub, config, workId, args[1], args[2], args[3], args[4], args[5], claimant)
 	if err != nil {
-		return shim.Error("Failed to get work: " + err.Error())
-	} else if workAsBytes != nil {
-		fmt.Println("This work already exists: " + workUid)
-		return shim.Error("This work already exists: " + workUid)
+		return shim.Error(err.Error())
 	}
 
-	// ==== Create work object and marshal to JSON ====
-	objectType := "work"
-	work := &work{objectType, workUid, workstartdate, workenddate, workexperience}
+	// ==== Marshal work to JSON ====
 	workJSONasBytes, err := json.Marshal(work)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	//Alternatively, build the work json string manually if you don't want to use struct marshalling
-	//workJSONasString := `{"docType":"Work",  "uid": "` + workUid + `", "workstartdate": "` + workstartdate + `", "workenddate": ` + strconv.Itoa(workenddate) + `, "workexperience": "` + workexperience + `"}`
+	//workJSONasString := `{"docType":"Work",  "workId": "` + workId + `", "workstartdate": "` + workstartdate + `", "workenddate": ` + strconv.Itoa(workenddate) + `, "workexperience": "` + workexperience + `"}`
 	//workJSONasBytes := []byte(str)
 
-	// === Save work to state ===
-	err = stub.PutState(workUid, workJSONasBytes)
+	// === Save work to state and index it to enable workstartdate-based range queries, e.g. return all blue works ===
+	err = workIndexes.PutState(stub, workId, workJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	//  ==== Index the work to enable workstartdate-based range queries, e.g. return all blue works ====
-	//  An 'index' is a normal key/value entry in state.
-	//  The key is a composite key, with the elements that you want to range query on listed first.
-	//  In our case, the composite key is based on indexUid~workstartdate~uid.
-	//  This will enable very efficient state range queries based on composite keys matching indexUid~workstartdate~*
-	indexUid := "workstartdate~uid"
-	workstartdateUidIndexKey, err := stub.CreateCompositeKey(indexUid, []string{work.Workstartdate, work.Uid})
+	err = setWorkEvent(stub, eventWorkCreated, work, claimant,
+		[]string{"workId", "workstartdate", "workenddate", "workexperience", "candidateUid", "employer", "status", "claimant"})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//  Save index entry to state. Only the key uid is needed, no need to store a duplicate copy of the work.
-	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
-	value := []byte{0x00}
-	stub.PutState(workstartdateUidIndexKey, value)
 
 	// ==== Work saved and indexed. Return success ====
 	fmt.Println("- end init work")
 	return shim.Success(nil)
 }
 
-// ===============================================
-// readWork - read a work from chaincode state
-// ===============================================
-func (t *SimpleChaincode) readWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var uid, jsonResp string
-	var err error
-
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting uid of the work to query")
+// ============================================================
+// newWork validates the fields of a new work and builds it.
+// initWork and initWorksBatch share it so both apply the same rules.
+// A new work is only a claim until the employer org attests it,
+// so the employer has to be an org the configuration allows to attest.
+// The first work of a uid binds the uid to the claimant, see dataSubject.
+// The dates are stored in the canonical yyyyMMddHHmmss UTC form.
+// Under the flag overlap policy the new work is marked conflicting with the works
+// of the uid it overlaps, those are left as they are, see checkWorkOverlaps.
+// ============================================================
+func newWork(stub shim.ChaincodeStubInterface, config *contractConfig, workId string, workstartdate string, workenddate string, workexperience string, uid string, employer string, claimant string) (*work, error) {
+	if len(workId) <= 0 {
+		return nil, fmt.Errorf("workId must be a non-empty string")
 	}
-
-	uid = args[0]
-	valAsbytes, err := stub.GetState(uid) //get the work from chaincode state
-	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + uid + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"Work does not exist: " + uid + "\"}"
-		return shim.Error(jsonResp)
+	if len(workstartdate) <= 0 {
+		return nil, fmt.Errorf("workstartdate must be a non-empty string")
 	}
-
-	return shim.Success(valAsbytes)
-}
-
-// ==================================================
-// delete - remove a work key/value pair from state
-// ==================================================
-func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var jsonResp string
-	var workJSON work
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	if len(workenddate) <= 0 {
+		return nil, fmt.Errorf("workenddate must be a non-empty string")
 	}
-	workUid := args[0]
-
-	// to maintain the workstartdate~uid index, we need to read the work first and get its workstartdate
-	valAsbytes, err := stub.GetState(workUid) //get the work from chaincode state
+	if len(workexperience) <= 0 {
+		return nil, fmt.Errorf("workexperience must be a non-empty string")
+	}
+	if len(uid) <= 0 {
+		return nil, fmt.Errorf("uid must be a non-empty string")
+	}
+	if len(employer) <= 0 {
+		return nil, fmt.Errorf("employer must be a non-empty string")
+	}
+	if !config.hasRole(employer, roleEmployer) {
+		return nil, fmt.Errorf("%s is not an employer org", employer)
+	}
+	start, end, err := config.workPeriod(workstartdate, workenddate)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + workUid + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"Work does not exist: " + workUid + "\"}"
-		return shim.Error(jsonResp)
+		return nil, err
 	}
-
-	err = json.Unmarshal([]byte(valAsbytes), &workJSON)
+	enddate, err := strconv.Atoi(end)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workUid + "\"}"
-		return shim.Error(jsonResp)
+		return nil, err
 	}
 
-	err = stub.DelState(workUid) //remove the work from chaincode state
+	workAsBytes, err := stub.GetState(workId)
 	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
+		return nil, fmt.Errorf("Failed to get work: %s", err)
+	} else if workAsBytes != nil {
+		fmt.Println("This work already exists: " + workId)
+		return nil, fmt.Errorf("This work already exists: %s", workId)
 	}
 
-	// maintain the index
-	indexUid := "workstartdate~uid"
-	workstartdateUidIndexKey, err := stub.CreateCompositeKey(indexUid, []string{workJSON.Workstartdate, workJSON.Uid})
+	w := &work{
+		ObjectType:     "work",
+		SchemaVersion:  workSchemaVersion,
+		WorkId:         workId,
+		Workstartdate:  start,
+		Workenddate:    enddate,
+		Workexperience: strings.ToLower(workexperience),
+		CandidateUid:   uid,
+		Employer:       employer,
+		Status:         statusPending,
+		Claimant:       claimant,
+	}
+	err = checkWorkOverlaps(stub, config, w)
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, err
 	}
-
-	//  Delete index entry to state.
-	err = stub.DelState(workstartdateUidIndexKey)
+	err = bindDataSubject(stub, uid, claimant)
 	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
+		return nil, err
 	}
-	return shim.Success(nil)
+	return w, nil
 }
 
-// ===========================================================
-// transfer a work by setting a new workexperience uid on the work
-// ===========================================================
-func (t *SimpleChaincode) transferWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+// ============================================================
+// initWorksBatch - create many works in one transaction.
+// Takes a JSON array of works with the fields of initWork, e.g.
+// [{"workId":"work5","workstartdate":"2019-06-03","workenddate":20200131180000,"workexperience":"tom","candidateUid":"...","employer":"Org2MSP"}]
+// Every item is validated like initWork. If any item is invalid the whole batch
+// fails, unless the optional second argument "true" asks to create the valid ones only.
+// The response lists the result of every item.
+// ============================================================
+func (t *SimpleChaincode) initWorksBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0       1
-	// "uid", "bob"
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	//   0              1
+	// "[{...},...]", "true"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
 	}
 
-	workUid := args[0]
-	newWorkexperience := strings.ToLower(args[1])
-	fmt.Println("- start transferWork ", workUid, newWorkexperience)
-
-	workAsBytes, err := stub.GetState(workUid)
+	var items []workBatchItem
+	err := json.Unmarshal([]byte(args[0]), &items)
 	if err != nil {
-		return shim.Error("Failed to get work:" + err.Error())
-	} else if workAsBytes == nil {
-		return shim.Error("Work does not exist")
+		return shim.Error("1st argument must be a JSON array of works: " + err.Error())
 	}
-
-	workToTransfer := work{}
-	err = json.Unmarshal(workAsBytes, &workToTransfer) //unmarshal it aka JSON.parse()
+	if len(items) == 0 {
+		return shim.Error("1st argument must hold at least one work")
+	}
+	config, err := getContractConfig(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	workToTransfer.Workexperience = newWorkexperience //change the workexperience
+	if !config.featureEnabled(featureBatchImport) {
+		return shim.Error("Batch import is disabled by the contract configuration")
+	}
+	if len(items) > config.maxWorksBatchSize() {
+		return shim.Error(fmt.Sprintf("A batch holds at most %d works, got %d", config.maxWorksBatchSize(), len(items)))
+	}
+	partial := false
+	if len(args) == 2 {
+		partial, err = strconv.ParseBool(args[1])
+		if err != nil {
+			return shim.Error("2nd argument must be a boolean string")
+		}
+	}
 
-	workJSONasBytes, _ := json.Marshal(workToTransfer)
-	err = stub.PutState(workUid, workJSONasBytes) //rewrite the work
+	// ==== Only candidate orgs may file a work ====
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimant, err := resolveCallerName(stub, caller)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	fmt.Println("- end transferWork (success)")
+	// ==== Validate every item before writing any of them ====
+	fmt.Printf("- start initWorksBatch with %d works\n", len(items))
+	response := workBatchResponse{Results: make([]workBatchResult, len(items))}
+	works := make([]*work, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		response.Results[i] = workBatchResult{Index: i, WorkId: item.WorkId}
+
+		// state does not show the writes of this transaction, so look for duplicates in the batch itself
+		if seen[item.WorkId] {
+			response.Results[i].Status = workBatchInvalid
+			response.Results[i].Error = "Duplicate workId in batch: " + item.WorkId
+			continue
+		}
+		seen[item.WorkId] = true
+
+		works[i], err = newWork(stub, config, item.WorkId, string(item.Workstartdate), string(item.Workenddate), item.Workexperience, item.CandidateUid, item.Employer, claimant)
+		if err != nil {
+			response.Results[i].Status = workBatchInvalid
+			response.Results[i].Error = err.Error()
+			continue
+		}
+		// newWork only sees the works in state, compare with the earlier works of the batch too
+		var overlapping []string
+		for _, other := range works[:i] {
+			if other != nil && other.CandidateUid == works[i].CandidateUid && workrecord.Overlap(works[i], other) {
+				overlapping = append(overlapping, other.WorkId)
+			}
+		}
+		if len(overlapping) > 0 && config.overlapPolicy() == overlapReject {
+			works[i] = nil
+			response.Results[i].Status = workBatchInvalid
+			response.Results[i].Error = fmt.Sprintf("Work %s overlaps works %s of the same uid", item.WorkId, strings.Join(overlapping, ", "))
+			continue
+		}
+		// like a work filed later, the later item of the batch carries the flag
+		for _, otherId := range overlapping {
+			workrecord.FlagConflict(works[i], otherId)
+		}
+		response.Results[i].Status = workBatchCreated
+	}
+
+	for _, result := range response.Results {
+		if result.Status == workBatchInvalid {
+			response.Invalid++
+		}
+	}
+	if response.Invalid > 0 && !partial {
+		for i := range response.Results {
+			if response.Results[i].Status == workBatchCreated {
+				response.Results[i].Status = workBatchSkipped
+			}
+		}
+		responseAsBytes, _ := json.Marshal(response)
+		return shim.Error(fmt.Sprintf("%d of %d works are invalid, nothing was created: %s", response.Invalid, len(items), responseAsBytes))
+	}
+
+	// === Save the valid works to state, the index entries are added with them ===
+	var createdWorkIds []string
+	for _, work := range works {
+		if work == nil {
+			continue
+		}
+		workJSONasBytes, err := json.Marshal(work)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = workIndexes.PutState(stub, work.WorkId, workJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		createdWorkIds = append(createdWorkIds, work.WorkId)
+	}
+	response.Created = len(createdWorkIds)
+
+	// Fabric delivers only the last event of a transaction, emit one for all works
+	if len(createdWorkIds) > 0 {
+		event := workEvent{
+			Type:          eventWorkCreated,
+			WorkIds:       createdWorkIds,
+			Actor:         claimant,
+			TxId:          stub.GetTxID(),
+			ChangedFields: []string{"workId", "workstartdate", "workenddate", "workexperience", "candidateUid", "employer", "status", "claimant"},
+		}
+		eventAsBytes, err := json.Marshal(event)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.SetEvent(eventWorkCreated, eventAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("- end initWorksBatch: %d created, %d invalid\n", response.Created, response.Invalid)
+	return shim.Success(responseAsBytes)
+}
+
+// ==========================================================================
+// initWorkPrivate - create a new work whose details stay in a private collection.
+// The details arrive in the transient field "work" so they never reach the
+// transaction payload; the public record only keeps their salted hashes.
+// ==========================================================================
+func (t *SimpleChaincode) initWorkPrivate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Private work data must be passed in transient map.")
+	}
+
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !config.featureEnabled(featurePrivateWorks) {
+		return shim.Error("Private works are disabled by the contract configuration")
+	}
+
+	// ==== Only candidate orgs may file a work ====
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimant, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- start init work private")
+	transMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Error getting transient: " + err.Error())
+	}
+	if _, ok := transMap["work"]; !ok {
+		return shim.Error("work must be a key in the transient map")
+	}
+
+	details := workPrivateDetails{}
+	err = json.Unmarshal(transMap["work"], &details)
+	if err != nil {
+		return shim.Error("Failed to decode JSON of: " + string(transMap["work"]))
+	}
+
+	// ==== Input sanitation ====
+	if len(details.WorkId) == 0 {
+		return shim.Error("workId field must be a non-empty string")
+	}
+	if len(details.CandidateUid) == 0 {
+		return shim.Error("candidateUid field must be a non-empty string")
+	}
+	if len(details.Workstartdate) == 0 {
+		return shim.Error("workstartdate field must be a non-empty string")
+	}
+	if details.Workenddate <= 0 {
+		return shim.Error("workenddate field must be a positive integer")
+	}
+	if len(details.Workexperience) == 0 {
+		return shim.Error("workexperience field must be a non-empty string")
+	}
+	if len(details.Employer) == 0 {
+		return shim.Error("employer field must be a non-empty string")
+	}
+	if !config.hasRole(details.Employer, roleEmployer) {
+		return shim.Error(details.Employer + " is not an employer org")
+	}
+	if len(details.Salt) < minSaltLength {
+		return shim.Error(fmt.Sprintf("salt field must be at least %d characters", minSaltLength))
+	}
+	// the dates are hashed in their stored form, a disclosure has to use it too
+	start, end, err := config.workPeriod(details.Workstartdate, strconv.Itoa(details.Workenddate))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	details.Workenddate, err = strconv.Atoi(end)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	details.ObjectType = "workPrivateDetails"
+	details.Workstartdate = start
+	details.Workexperience = strings.ToLower(details.Workexperience)
+
+	// ==== Check if work already exists ====
+	workAsBytes, err := stub.GetState(details.WorkId)
+	if err != nil {
+		return shim.Error("Failed to get work: " + err.Error())
+	} else if workAsBytes != nil {
+		fmt.Println("This work already exists: " + details.WorkId)
+		return shim.Error("This work already exists: " + details.WorkId)
+	}
+	err = bindDataSubject(stub, details.CandidateUid, claimant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Save the public metadata and hashes to state ====
+	hash, fieldHashes, err := hashWorkDetails(&details)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	work := &work{
+		ObjectType:    "work",
+		SchemaVersion: workSchemaVersion,
+		WorkId:        details.WorkId,
+		CandidateUid:  details.CandidateUid,
+		Employer:      details.Employer,
+		Status:        statusPending,
+		Claimant:      claimant,
+		Hash:          hash,
+		FieldHashes:   fieldHashes,
+	}
+	workJSONasBytes, err := json.Marshal(work)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = workIndexes.PutState(stub, details.WorkId, workJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Save the full record to the private collection ====
+	detailsJSONasBytes, err := json.Marshal(details)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutPrivateData(collectionWorkPrivateDetails, details.WorkId, detailsJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the event is public, so it only names the public fields
+	err = setWorkEvent(stub, eventWorkCreated, work, claimant,
+		[]string{"workId", "candidateUid", "employer", "status", "claimant", "hash", "fieldHashes"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Work saved. Return success ====
+	fmt.Println("- end init work private")
 	return shim.Success(nil)
 }
 
+// ===============================================
+// readWork - read a work from chaincode state
+// Only verified works are returned unless the optional second argument
+// "true" asks for pending, rejected and revoked works as well. Those are
+// returned to the data subject, the employer org named on the work and
+// admins only, a grant covers verified works.
+// ===============================================
+func (t *SimpleChaincode) readWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var workId, jsonResp string
+	var err error
+
+	//   0          1
+	// "workId", "true"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting workId of the work to query")
+	}
+
+	workId = args[0]
+	includeUnverified := false
+	if len(args) == 2 {
+		includeUnverified, err = strconv.ParseBool(args[1])
+		if err != nil {
+			return shim.Error("2nd argument must be a boolean string")
+		}
+	}
+
+	valAsbytes, err := stub.GetState(workId) //get the work from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + workId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Work does not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	workJSON := work{}
+	err = workrecord.Decode(workId, valAsbytes, &workJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	// the access checks come first, so a caller without access learns nothing of the status
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(workJSON.CandidateUid, workJSON.Employer, scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		jsonResp = "{\"Error\":\"" + access.caller.MSPID + " has no active grant to read work " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+	// an unverified work is an open claim, only its parties and admins read it
+	if workJSON.Status != statusVerified && !access.admin {
+		party, err := access.party(workJSON.CandidateUid, workJSON.Employer)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !party {
+			jsonResp = "{\"Error\":\"Only the data subject, the employer org and admins may read unverified work " + workId + "\"}"
+			return shim.Error(jsonResp)
+		}
+	}
+	if !includeUnverified && workJSON.Status != statusVerified {
+		jsonResp = "{\"Error\":\"Work is not verified: " + workId + " is " + workJSON.Status + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	// works in an old layout are returned in the current one
+	workJSONasBytes, err := json.Marshal(workJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(workJSONasBytes)
+}
+
+// ===============================================================
+// exportWorkCredential - export a verified work of a uid as a W3C
+// Verifiable Credential issued by the DID of the employer org.
+// The proof anchors the credential to the attesting transaction and to the
+// work record as readWork returns it, see package workcredential to verify it.
+// The issuance date is the transaction time, so every peer builds the same credential.
+// ===============================================================
+func (t *SimpleChaincode) exportWorkCredential(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1
+	// "uid", "workId"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	uid := args[0]
+	workId := args[1]
+
+	workAsBytes, err := stub.GetState(workId)
+	if err != nil {
+		return shim.Error("Failed to get work:" + err.Error())
+	} else if workAsBytes == nil {
+		return shim.Error("Work does not exist: " + workId)
+	}
+	workToExport := work{}
+	err = workrecord.Decode(workId, workAsBytes, &workToExport)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if workToExport.CandidateUid != uid {
+		return shim.Error("Work " + workId + " does not belong to uid " + uid)
+	}
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(uid, workToExport.Employer, scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		return shim.Error(access.caller.MSPID + " has no active grant to read work " + workId)
+	}
+	if workToExport.Status != statusVerified {
+		return shim.Error("Work " + workId + " is " + workToExport.Status + ", only verified works can be exported")
+	}
+	if workToExport.Hash != "" {
+		return shim.Error("Work " + workId + " keeps its details private and cannot be exported")
+	}
+	// the record as readWork returns it, which is what a verifier will compare with
+	recordAsBytes, err := json.Marshal(workToExport)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	attestTxId, attestedAt, err := getAttestation(stub, workId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("Failed to get tx timestamp:" + err.Error())
+	}
+
+	channel := stub.GetChannelID()
+	issuer := workcredential.IssuerDID(channel, workToExport.Employer)
+	credential := &workcredential.Credential{
+		Context:      []string{workcredential.ContextCredentialsV1},
+		Id:           workcredential.CredentialId(channel, workId),
+		Type:         []string{workcredential.TypeVerifiableCredential, workcredential.TypeEmploymentCredential},
+		Issuer:       issuer,
+		IssuanceDate: time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339),
+		CredentialSubject: workcredential.Subject{
+			Id:             workcredential.SubjectId(uid),
+			WorkId:         workId,
+			Workstartdate:  workToExport.Workstartdate,
+			Workenddate:    workToExport.Workenddate,
+			Workexperience: workToExport.Workexperience,
+			Employer:       workToExport.Employer,
+		},
+	}
+	err = workcredential.Seal(credential, workcredential.Proof{
+		Type:               workcredential.ProofTypeLedgerAnchor,
+		Created:            attestedAt,
+		ProofPurpose:       workcredential.ProofPurposeAssertion,
+		VerificationMethod: issuer + "#ledger",
+		Channel:            channel,
+		TxId:               attestTxId,
+		Reviewer:           workToExport.Reviewer,
+		RecordHash:         workcredential.RecordHash(recordAsBytes),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	credentialAsBytes, err := json.Marshal(credential)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(credentialAsBytes)
+}
+
+// ===============================================================
+// getAttestation finds the transaction that attested the current
+// verified state of a work in its history, and when it happened.
+// The history comes in commit order, the tx timestamps are only
+// proposed by clients and are not used to order it.
+// ===============================================================
+func getAttestation(stub shim.ChaincodeStubInterface, workId string) (string, string, error) {
+	resultsIterator, err := stub.GetHistoryForKey(workId)
+	if err != nil {
+		return "", "", err
+	}
+	defer resultsIterator.Close()
+
+	type modification struct {
+		txId     string
+		modified time.Time
+		verified bool
+	}
+	var modifications []modification
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return "", "", err
+		}
+		verified := false
+		if !response.IsDelete {
+			var record work
+			verified = workrecord.Decode(workId, response.Value, &record) == nil && record.Status == statusVerified
+		}
+		modifications = append(modifications, modification{
+			txId:     response.TxId,
+			modified: time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC(),
+			verified: verified,
+		})
+	}
+	// the attestation starts the run of verified versions that ends with the current one
+	attestation := -1
+	for i := len(modifications) - 1; i >= 0 && modifications[i].verified; i-- {
+		attestation = i
+	}
+	if attestation < 0 {
+		return "", "", fmt.Errorf("No attestation of work %s found in its history", workId)
+	}
+	return modifications[attestation].txId, modifications[attestation].modified.Format(time.RFC3339), nil
+}
+
+// ===============================================================
+// readWorkAudited - read a work like readWork and record who read it,
+// for which purpose and when under access~uid~txid. It has to be
+// submitted as an invoke, a query leaves no access entry behind.
+// ===============================================================
+func (t *SimpleChaincode) readWorkAudited(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1              2
+	// "workId", "RECRUITMENT", "true"
+	if len(args) < 2 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	purpose := args[1]
+	if !containsString(accessPurposes, purpose) {
+		return shim.Error("2nd argument must be one of " + strings.Join(accessPurposes, ", "))
+	}
+
+	// readWork checks the grants of the caller
+	readArgs := []string{args[0]}
+	if len(args) == 3 {
+		readArgs = append(readArgs, args[2])
+	}
+	response := t.readWork(stub, readArgs)
+	if response.Status != shim.OK {
+		return response
+	}
+	workJSON := work{}
+	err := json.Unmarshal(response.Payload, &workJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	callerName, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("Failed to get tx timestamp:" + err.Error())
+	}
+
+	entry := accessLogEntry{
+		ObjectType: "accessLogEntry",
+		Uid:        workJSON.CandidateUid,
+		WorkId:     workJSON.WorkId,
+		CallerMSP:  caller.MSPID,
+		Caller:     callerName,
+		Purpose:    purpose,
+		TxId:       stub.GetTxID(),
+		Timestamp:  time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339Nano),
+	}
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	entryKey, err := stub.CreateCompositeKey(accessLogIndex, []string{entry.Uid, entry.TxId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(entryKey, entryAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(response.Payload)
+}
+
+// ===============================================================
+// getAccessLogForUid - list the audited reads of the works of a uid,
+// so the person can see who accessed their records.
+// Entries are ordered by their tx timestamps. Those are proposed by the
+// clients, so the order is only approximate and may differ from the
+// order in which the reads were committed to the ledger.
+// Only the data subject of the uid and admin orgs may read the access log.
+// ===============================================================
+func (t *SimpleChaincode) getAccessLogForUid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "uid"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	caller, err := authorize(stub, roleCandidate, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !config.hasRole(caller.MSPID, roleAdmin) {
+		callerName, err := resolveCallerName(stub, caller)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkDataSubject(stub, args[0], callerName)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(accessLogIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	entries := []accessLogEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var entry accessLogEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return shim.Error("Failed to decode access entry: " + err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	// the keys are ordered by txid, order the reads by the time their clients proposed them.
+	// Each entry has a key of its own, so the ledger order of the entries is not available.
+	sort.SliceStable(entries, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, entries[i].Timestamp)
+		tj, _ := time.Parse(time.RFC3339Nano, entries[j].Timestamp)
+		return ti.Before(tj)
+	})
+
+	entriesAsBytes, err := json.Marshal(entries)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(entriesAsBytes)
+}
+
+// ===============================================================
+// grantAccess - let an org read the works of a uid until expiresAt.
+// The scope is works, history or all. Granting again replaces the
+// expiry of an existing grant. Only the data subject of the uid may grant access.
+// ===============================================================
+func (t *SimpleChaincode) grantAccess(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1          2        3
+	// "uid", "Org4MSP", "works", "2019-12-31T00:00:00Z"
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+	uid := args[0]
+	granteeMSP := args[1]
+	scope := args[2]
+	if len(uid) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(granteeMSP) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	if !containsString(accessScopes, scope) {
+		return shim.Error("3rd argument must be one of " + strings.Join(accessScopes, ", "))
+	}
+	expiresAt, err := parseTimestampArg(args[3])
+	if err != nil {
+		return shim.Error("4th argument must be an RFC3339 or unix timestamp: " + err.Error())
+	}
+
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	grantedBy, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDataSubject(stub, uid, grantedBy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("Failed to get tx timestamp:" + err.Error())
+	}
+	if !expiresAt.After(time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos))) {
+		return shim.Error("4th argument must be in the future")
+	}
+
+	grant := accessGrant{
+		ObjectType: "accessGrant",
+		Uid:        uid,
+		GranteeMSP: granteeMSP,
+		Scope:      scope,
+		ExpiresAt:  expiresAt.UTC().Format(time.RFC3339Nano),
+		GrantedBy:  grantedBy,
+		TxId:       stub.GetTxID(),
+	}
+	grantAsBytes, err := json.Marshal(grant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	grantKey, err := stub.CreateCompositeKey(grantIndex, []string{uid, granteeMSP, scope})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(grantKey, grantAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(grantAsBytes)
+}
+
+// ===============================================================
+// revokeAccess - withdraw a grant before it expires.
+// Only the data subject of the uid may revoke access.
+// ===============================================================
+func (t *SimpleChaincode) revokeAccess(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1          2
+	// "uid", "Org4MSP", "works"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	revokedBy, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDataSubject(stub, args[0], revokedBy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	grant, err := getAccessGrant(stub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if grant == nil {
+		return shim.Error("No " + args[2] + " grant of uid " + args[0] + " to " + args[1])
+	}
+	grantKey, err := stub.CreateCompositeKey(grantIndex, []string{args[0], args[1], args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(grantKey)
+	if err != nil {
+		return shim.Error("Failed to delete state:" + err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ===============================================================
+// readWorkPrivate - read the private details of a work.
+// The data subject, the employer named on the work and orgs with an
+// active works grant of the uid may read them, see accessChecker.
+// ===============================================================
+func (t *SimpleChaincode) readWorkPrivate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting workId of the work to query")
+	}
+	workId := args[0]
+
+	valAsbytes, err := stub.GetState(workId)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + workId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Work does not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+	workJSON := work{}
+	err = workrecord.Decode(workId, valAsbytes, &workJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(workJSON.CandidateUid, workJSON.Employer, scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		return shim.Error(access.caller.MSPID + " has no active grant to read the private details of " + workId)
+	}
+
+	detailsAsBytes, err := stub.GetPrivateData(collectionWorkPrivateDetails, workId)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get private details for " + workId + ": " + err.Error() + "\"}"
+		return shim.Error(jsonResp)
+	} else if detailsAsBytes == nil {
+		jsonResp = "{\"Error\":\"Work private details do not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	return shim.Success(detailsAsBytes)
+}
+
+// ===============================================================
+// verifyWorkDisclosure - check a work shown off-chain against the ledger.
+// The disclosed JSON has the workPrivateDetails layout. For private works
+// it is rehashed with the salt and compared to the public hashes, for
+// public works it is compared to the stored values and the salt must be empty.
+// The disclosed dates may be in the stored form or in any form initWork accepts.
+// ===============================================================
+func (t *SimpleChaincode) verifyWorkDisclosure(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+
+	//   0            1                2
+	// "workId", "disclosedJSON", "salt"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	workId := args[0]
+
+	valAsbytes, err := stub.GetState(workId)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + workId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Work does not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+	workJSON := work{}
+	err = workrecord.Decode(workId, valAsbytes, &workJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+	// a match tells the caller the ledger values, so it is a read of the work
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(workJSON.CandidateUid, workJSON.Employer, scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		return shim.Error(access.caller.MSPID + " has no active grant to verify work " + workId)
+	}
+
+	disclosed := workPrivateDetails{}
+	err = json.Unmarshal([]byte(args[1]), &disclosed)
+	if err != nil {
+		return shim.Error("2nd argument must be the disclosed work JSON: " + err.Error())
+	}
+	if workJSON.Hash == "" && args[2] != "" {
+		return shim.Error("3rd argument must be empty, work " + workId + " is public and has no salt")
+	}
+	// the ledger holds the dates in their stored form. Disclosed values in that form,
+	// e.g. the output of readWorkPrivate, are taken as they are, others are
+	// normalized the way initWork and initWorkPrivate do
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	start, end, err := config.storedWorkPeriod(disclosed.Workstartdate, strconv.Itoa(disclosed.Workenddate))
+	if err != nil {
+		return shim.Error("2nd argument must hold valid dates: " + err.Error())
+	}
+	disclosed.Workenddate, err = strconv.Atoi(end)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disclosed.ObjectType = "workPrivateDetails"
+	disclosed.Workstartdate = start
+	disclosed.Workexperience = strings.ToLower(disclosed.Workexperience)
+	disclosed.Salt = args[2]
+	if disclosed.WorkId == "" {
+		disclosed.WorkId = workId
+	}
+
+	result := disclosureResult{WorkId: workId, Status: workJSON.Status, Mismatches: []fieldMismatch{}}
+	mismatch := func(field string, value string, reason string) {
+		result.Mismatches = append(result.Mismatches, fieldMismatch{field, value, reason})
+	}
+
+	// the identifying fields are public for every work
+	if disclosed.WorkId != workJSON.WorkId {
+		mismatch("workId", disclosed.WorkId, "differs from the ledger")
+	}
+	if disclosed.CandidateUid != workJSON.CandidateUid {
+		mismatch("candidateUid", disclosed.CandidateUid, "differs from the ledger")
+	}
+	if disclosed.Employer != workJSON.Employer {
+		mismatch("employer", disclosed.Employer, "differs from the ledger")
+	}
+
+	disclosedFields := map[string]string{
+		"workstartdate":  disclosed.Workstartdate,
+		"workenddate":    strconv.Itoa(disclosed.Workenddate),
+		"workexperience": disclosed.Workexperience,
+	}
+	fieldNames := []string{"workstartdate", "workenddate", "workexperience"}
+
+	if workJSON.Hash != "" {
+		result.ComparedTo = "publicHash"
+		hash, fieldHashes, err := hashWorkDetails(&disclosed)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for _, name := range fieldNames {
+			if fieldHashes[name] != workJSON.FieldHashes[name] {
+				mismatch(name, disclosedFields[name], "salted hash differs from the ledger")
+			}
+		}
+		// catches a wrong salt or a change the field hashes do not cover
+		if hash != workJSON.Hash && len(result.Mismatches) == 0 {
+			mismatch("", "", "record hash differs from the ledger")
+		}
+	} else {
+		result.ComparedTo = "publicRecord"
+		storedFields := map[string]string{
+			"workstartdate":  workJSON.Workstartdate,
+			"workenddate":    strconv.Itoa(workJSON.Workenddate),
+			"workexperience": workJSON.Workexperience,
+		}
+		for _, name := range fieldNames {
+			if disclosedFields[name] != storedFields[name] {
+				mismatch(name, disclosedFields[name], "differs from the ledger")
+			}
+		}
+	}
+	result.Match = len(result.Mismatches) == 0
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// ==================================================
+// delete - revoke a work. The record and its index entries stay in
+// state, marked revoked with the reason code, the revoking identity and
+// the tx timestamp. Use purgeWork to remove a work for good.
+// The data subject of the work's uid, the employer org named on the work
+// and admins may revoke it.
+// ==================================================
+func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+	var workJSON work
+
+	//   0          1
+	// "workId", "ENTERED_IN_ERROR"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	workId := args[0]
+	reason := strings.ToUpper(args[1])
+	if !isRevocationReason(reason) {
+		return shim.Error("2nd argument must be one of " + strings.Join(revocationReasons, ", "))
+	}
+
+	valAsbytes, err := stub.GetState(workId) //get the work from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + workId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Work does not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	err = workrecord.Decode(workId, valAsbytes, &workJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actor, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !config.hasRole(caller.MSPID, roleAdmin) &&
+		!(config.hasRole(caller.MSPID, roleEmployer) && caller.MSPID == workJSON.Employer) {
+		if !config.hasRole(caller.MSPID, roleCandidate) {
+			return shim.Error(caller.MSPID + " is not authorized to revoke work " + workId)
+		}
+		// a candidate may only revoke the works of its own uid
+		err = checkDataSubject(stub, workJSON.CandidateUid, actor)
+		if err != nil {
+			return shim.Error("Not authorized to revoke work " + workId + ": " + err.Error())
+		}
+	}
+	if workJSON.Status == statusRevoked {
+		return shim.Error("Work " + workId + " is already revoked")
+	}
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("Failed to get tx timestamp:" + err.Error())
+	}
+
+	workJSON.Status = statusRevoked
+	workJSON.RevokedReason = reason
+	workJSON.RevokedBy = actor
+	workJSON.RevokedAt = time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339Nano)
+
+	workJSONasBytes, _ := json.Marshal(workJSON)
+	err = workIndexes.PutState(stub, workId, workJSONasBytes) //rewrite the work and move its index entries
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = keepWorkEndorsementPolicy(stub, workId, workJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setWorkEvent(stub, eventWorkRevoked, &workJSON, actor, []string{"status", "revokedReason", "revokedBy", "revokedAt"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ==================================================
+// purgeWork - remove a work key/value pair from state.
+// Only admins may purge, revoke works with delete instead.
+// ==================================================
+func (t *SimpleChaincode) purgeWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+	var workJSON work
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	workId := args[0]
+
+	caller, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actor, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	valAsbytes, err := stub.GetState(workId) //get the work from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + workId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Work does not exist: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	err = workrecord.Decode(workId, valAsbytes, &workJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + workId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	err = workIndexes.DelState(stub, workId) //remove the work and its index entries from chaincode state
+	if err != nil {
+		return shim.Error("Failed to delete state:" + err.Error())
+	}
+
+	err = setWorkEvent(stub, eventWorkDeleted, &workJSON, actor, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// private works keep their details in the collection
+	if workJSON.Hash != "" {
+		err = stub.DelPrivateData(collectionWorkPrivateDetails, workId)
+		if err != nil {
+			return shim.Error("Failed to delete private details:" + err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+// isRevocationReason reports whether reason is a known revocation reason code
+func isRevocationReason(reason string) bool {
+	for _, r := range revocationReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// getWorkRecord reads the work stored under workId, nil if there is none
+func getWorkRecord(stub shim.ChaincodeStubInterface, workId string) (*work, error) {
+	workAsBytes, err := stub.GetState(workId)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get work %s: %s", workId, err)
+	} else if workAsBytes == nil {
+		return nil, nil
+	}
+	record := &work{}
+	err = workrecord.Decode(workId, workAsBytes, record)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode JSON of %s: %s", workId, err)
+	}
+	return record, nil
+}
+
+// ===========================================================
+// transfer a work by setting a new workexperience on the work.
+// Only the data subject of the work's uid may transfer it.
+// ===========================================================
+func (t *SimpleChaincode) transferWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0       1
+	// "uid", "bob"
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	workId := args[0]
+	newWorkexperience := strings.ToLower(args[1])
+	fmt.Println("- start transferWork ", workId, newWorkexperience)
+
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !config.featureEnabled(featureTransfers) {
+		return shim.Error("Transfers are disabled by the contract configuration")
+	}
+
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actor, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	workAsBytes, err := stub.GetState(workId)
+	if err != nil {
+		return shim.Error("Failed to get work:" + err.Error())
+	} else if workAsBytes == nil {
+		return shim.Error("Work does not exist")
+	}
+
+	workToTransfer := work{}
+	err = workrecord.Decode(workId, workAsBytes, &workToTransfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the transfer resets the attestation, so it is for the candidate the work belongs to only
+	err = checkDataSubject(stub, workToTransfer.CandidateUid, actor)
+	if err != nil {
+		return shim.Error("Not authorized to transfer work " + workId + ": " + err.Error())
+	}
+	if workToTransfer.Hash != "" {
+		return shim.Error("Work " + workId + " keeps its workexperience private and cannot be transferred")
+	}
+	if workToTransfer.Status == statusRevoked {
+		return shim.Error("Work " + workId + " is revoked and cannot be transferred")
+	}
+	workToTransfer.Workexperience = newWorkexperience //change the workexperience
+	// the employer attested the old content, so the changed record is a new claim
+	workToTransfer.Status = statusPending
+	workToTransfer.Reviewer = ""
+	workToTransfer.ReviewReason = ""
+
+	workJSONasBytes, _ := json.Marshal(workToTransfer)
+	err = workIndexes.PutState(stub, workId, workJSONasBytes) //rewrite the work and move its index entries
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = keepWorkEndorsementPolicy(stub, workId, workJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setWorkEvent(stub, eventWorkTransferred, &workToTransfer, actor, []string{"workexperience", "status", "reviewer", "reviewReason"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transferWork (success)")
+	return shim.Success(nil)
+}
+
+// ===========================================================
+// attestWork - the employer org confirms a pending work
+// ===========================================================
+func (t *SimpleChaincode) attestWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "workId"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	return t.reviewWork(stub, args[0], statusVerified, "")
+}
+
+// ===========================================================
+// rejectWork - the employer org rejects a pending work
+// ===========================================================
+func (t *SimpleChaincode) rejectWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1
+	// "workId", "reason"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	return t.reviewWork(stub, args[0], statusRejected, args[1])
+}
+
+// ===========================================================
+// authorize checks that the caller's org plays one of the
+// allowed roles and returns the caller identity
+// ===========================================================
+func authorize(stub shim.ChaincodeStubInterface, allowed ...string) (*identity.Caller, error) {
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, want := range allowed {
+		if config.hasRole(caller.MSPID, want) {
+			return caller, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not authorized, expecting one of the roles %s", caller.MSPID, strings.Join(allowed, ", "))
+}
+
+// newAccessChecker returns the access checker of the caller of the transaction
+func newAccessChecker(stub shim.ChaincodeStubInterface) (*accessChecker, error) {
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	name, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return nil, err
+	}
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get tx timestamp: %s", err)
+	}
+	return &accessChecker{
+		stub:     stub,
+		caller:   caller,
+		name:     name,
+		admin:    config.hasRole(caller.MSPID, roleAdmin),
+		now:      time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(),
+		subjects: make(map[string]string),
+		granted:  make(map[string]bool),
+	}, nil
+}
+
+// allowed reports whether the caller may read the works of uid at employer in scope.
+// Pass an empty employer to ask for the whole record of the uid.
+func (a *accessChecker) allowed(uid string, employer string, scope string) (bool, error) {
+	party, err := a.party(uid, employer)
+	if err != nil || party {
+		return party, err
+	}
+	cacheKey := uid + "\x00" + scope
+	if granted, ok := a.granted[cacheKey]; ok {
+		return granted, nil
+	}
+	granted := false
+	for _, grantScope := range []string{scope, scopeAll} {
+		grant, err := getAccessGrant(a.stub, uid, a.caller.MSPID, grantScope)
+		if err != nil {
+			return false, err
+		}
+		if grant != nil && grant.active(a.now) {
+			granted = true
+			break
+		}
+	}
+	a.granted[cacheKey] = granted
+	return granted, nil
+}
+
+// party reports whether the caller is the data subject of uid or the employer org
+// named on the work, the two sides of a work claim
+func (a *accessChecker) party(uid string, employer string) (bool, error) {
+	if employer != "" && employer == a.caller.MSPID {
+		return true, nil
+	}
+	subject, ok := a.subjects[uid]
+	if !ok {
+		bound, err := getDataSubject(a.stub, uid)
+		if err != nil {
+			return false, err
+		}
+		if bound != nil {
+			subject = bound.Subject
+		}
+		a.subjects[uid] = subject
+	}
+	return subject != "" && subject == a.name, nil
+}
+
+// allowedRecord reports whether the caller may read a document in scope.
+// Grants, data subjects and access log entries belong to the person of their uid.
+// Documents without a uid do not belong to a person and are always readable.
+func (a *accessChecker) allowedRecord(value []byte, scope string) (bool, error) {
+	var record struct {
+		ObjectType   string `json:"docType"`
+		Uid          string `json:"uid"`
+		CandidateUid string `json:"candidateUid"`
+		Employer     string `json:"employer"`
+	}
+	if json.Unmarshal(value, &record) != nil {
+		return true, nil
+	}
+	uid := record.CandidateUid
+	if record.ObjectType != "work" {
+		uid = record.Uid
+	}
+	if uid == "" {
+		return true, nil
+	}
+	return a.allowed(uid, record.Employer, scope)
+}
+
+// checkWorkAccess fails unless the caller may read the work in scope. A purged work
+// is judged by the last version in its history.
+func (a *accessChecker) checkWorkAccess(workId string, scope string) error {
+	value, err := a.stub.GetState(workId)
+	if err != nil {
+		return fmt.Errorf("Failed to get work %s: %s", workId, err)
+	}
+	if value == nil {
+		resultsIterator, err := a.stub.GetHistoryForKey(workId)
+		if err != nil {
+			return err
+		}
+		defer resultsIterator.Close()
+		// the history comes in commit order
+		for resultsIterator.HasNext() {
+			response, err := resultsIterator.Next()
+			if err != nil {
+				return err
+			}
+			if !response.IsDelete {
+				value = response.Value
+			}
+		}
+	}
+	allowed, err := a.allowedRecord(value, scope)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%s has no active %s grant to read work %s", a.caller.MSPID, scope, workId)
+	}
+	return nil
+}
+
+// getAccessGrant reads a grant, nil if there is none
+func getAccessGrant(stub shim.ChaincodeStubInterface, uid string, granteeMSP string, scope string) (*accessGrant, error) {
+	grantKey, err := stub.CreateCompositeKey(grantIndex, []string{uid, granteeMSP, scope})
+	if err != nil {
+		return nil, err
+	}
+	grantAsBytes, err := stub.GetState(grantKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get grant: %s", err)
+	} else if grantAsBytes == nil {
+		return nil, nil
+	}
+	grant := &accessGrant{}
+	err = json.Unmarshal(grantAsBytes, grant)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode grant: %s", err)
+	}
+	return grant, nil
+}
+
+// getDataSubject reads the subject a uid is bound to, nil if there is none
+func getDataSubject(stub shim.ChaincodeStubInterface, uid string) (*dataSubject, error) {
+	subjectKey, err := stub.CreateCompositeKey(subjectIndex, []string{uid})
+	if err != nil {
+		return nil, err
+	}
+	subjectAsBytes, err := stub.GetState(subjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get data subject: %s", err)
+	} else if subjectAsBytes == nil {
+		return nil, nil
+	}
+	subject := &dataSubject{}
+	err = json.Unmarshal(subjectAsBytes, subject)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode data subject: %s", err)
+	}
+	return subject, nil
+}
+
+// bindDataSubject binds uid to the identity named name unless it is bound already.
+// It fails if the uid belongs to another identity.
+func bindDataSubject(stub shim.ChaincodeStubInterface, uid string, name string) error {
+	subject, err := getDataSubject(stub, uid)
+	if err != nil {
+		return err
+	}
+	if subject != nil {
+		if subject.Subject != name {
+			return fmt.Errorf("uid %s belongs to another identity than %s", uid, name)
+		}
+		return nil
+	}
+	subjectAsBytes, err := json.Marshal(dataSubject{ObjectType: "dataSubject", Uid: uid, Subject: name, TxId: stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	subjectKey, err := stub.CreateCompositeKey(subjectIndex, []string{uid})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(subjectKey, subjectAsBytes)
+}
+
+// checkDataSubject fails unless uid is bound to the identity named name
+func checkDataSubject(stub shim.ChaincodeStubInterface, uid string, name string) error {
+	subject, err := getDataSubject(stub, uid)
+	if err != nil {
+		return err
+	}
+	if subject == nil {
+		return fmt.Errorf("No work has been filed for uid %s", uid)
+	}
+	if subject.Subject != name {
+		return fmt.Errorf("%s is not the data subject of uid %s", name, uid)
+	}
+	return nil
+}
+
+// active reports whether the grant has not expired at now
+func (g *accessGrant) active(now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339Nano, g.ExpiresAt)
+	return err == nil && now.Before(expiresAt)
+}
+
+// hasRole reports whether the org plays the given role. The admin and
+// employer orgs listed in the configuration replace those of orgRoles.
+func (c *contractConfig) hasRole(mspId string, role string) bool {
+	if role == roleAdmin && len(c.AdminMSPs) > 0 {
+		return containsString(c.AdminMSPs, mspId)
+	}
+	if role == roleEmployer && len(c.EmployerMSPs) > 0 {
+		return containsString(c.EmployerMSPs, mspId)
+	}
+	return containsString(orgRoles[mspId], role)
+}
+
+// featureEnabled reports whether a feature toggle is on, toggles are on unless set false
+func (c *contractConfig) featureEnabled(feature string) bool {
+	enabled, ok := c.Features[feature]
+	return !ok || enabled
+}
+
+// identityConfig returns the identity strategy of the configuration
+func (c *contractConfig) identityConfig() identity.Config {
+	return identity.Config{Strategy: c.IdentityStrategy, Pattern: c.IdentityPattern, Attribute: c.IdentityAttribute}
+}
+
+func (c *contractConfig) dateFormat() string {
+	if c.DateFormat == "" {
+		return defaultDateFormat
+	}
+	return c.DateFormat
+}
+
+// location returns the timezone of dates given without one, UTC by default
+func (c *contractConfig) location() (*time.Location, error) {
+	return workdate.Location(c.Timezone)
+}
+
+// parseWorkDate parses a work date given in the configured dateFormat or in ISO-8601.
+// Dates without a zone are taken in the configured timezone.
+func (c *contractConfig) parseWorkDate(value string) (time.Time, error) {
+	location, err := c.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return workdate.Parse(value, c.dateFormat(), location)
+}
+
+// parseStoredWorkDate parses a work date that refers to a stored one, see workdate.ParseKey.
+// Values in the stored form are UTC and are not shifted into the configured timezone.
+func (c *contractConfig) parseStoredWorkDate(value string) (time.Time, error) {
+	location, err := c.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return workdate.ParseKey(value, c.dateFormat(), location)
+}
+
+// workPeriod parses the start and end date of a work and returns them in the stored form.
+// The period must end after it starts.
+func (c *contractConfig) workPeriod(workstartdate string, workenddate string) (string, string, error) {
+	return c.period(c.parseWorkDate, workstartdate, workenddate)
+}
+
+// storedWorkPeriod is workPeriod for dates that refer to stored ones, such as a disclosed record
+func (c *contractConfig) storedWorkPeriod(workstartdate string, workenddate string) (string, string, error) {
+	return c.period(c.parseStoredWorkDate, workstartdate, workenddate)
+}
+
+func (c *contractConfig) period(parse func(string) (time.Time, error), workstartdate string, workenddate string) (string, string, error) {
+	start, err := parse(workstartdate)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid workstartdate: %s", err)
+	}
+	end, err := parse(workenddate)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid workenddate: %s", err)
+	}
+	if !end.After(start) {
+		return "", "", fmt.Errorf("workenddate %s must be after workstartdate %s", workenddate, workstartdate)
+	}
+	return workdate.Format(start), workdate.Format(end), nil
+}
+
+func (c *contractConfig) overlapPolicy() string {
+	if c.OverlapPolicy == "" {
+		return overlapReject
+	}
+	return c.OverlapPolicy
+}
+
+func (c *contractConfig) maxWorksBatchSize() int {
+	if c.MaxWorksBatchSize == 0 {
+		return defaultMaxWorksBatchSize
+	}
+	return c.MaxWorksBatchSize
+}
+
+func (c *contractConfig) maxMigrationBatchSize() int {
+	if c.MaxMigrationBatchSize == 0 {
+		return defaultMaxMigrationBatchSize
+	}
+	return c.MaxMigrationBatchSize
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ===========================================================
+// hashWorkDetails returns the salted hash of the whole record
+// and of every sensitive field on its own, so a disclosure can
+// be checked field by field without revealing the others
+// ===========================================================
+func hashWorkDetails(details *workPrivateDetails) (string, map[string]string, error) {
+	fields := map[string]string{
+		"workstartdate":  details.Workstartdate,
+		"workenddate":    strconv.Itoa(details.Workenddate),
+		"workexperience": details.Workexperience,
+	}
+	fieldHashes := make(map[string]string, len(fields))
+	for name, value := range fields {
+		fieldHashes[name] = saltedHash(details.Salt, name+"\x00"+value)
+	}
+
+	// the salt itself is not part of the hashed record
+	unsalted := *details
+	unsalted.Salt = ""
+	recordAsBytes, err := json.Marshal(unsalted)
+	if err != nil {
+		return "", nil, err
+	}
+	return saltedHash(details.Salt, string(recordAsBytes)), fieldHashes, nil
+}
+
+func saltedHash(salt string, value string) string {
+	sum := sha256.Sum256([]byte(salt + "\x00" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// ===========================================================
+// setWorkEvent emits the chaincode event for a change to one work
+// ===========================================================
+func setWorkEvent(stub shim.ChaincodeStubInterface, eventType string, w *work, actor string, changedFields []string) error {
+	event := workEvent{
+		Type:          eventType,
+		WorkId:        w.WorkId,
+		Uid:           w.CandidateUid,
+		Actor:         actor,
+		TxId:          stub.GetTxID(),
+		ChangedFields: changedFields,
+	}
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = stub.SetEvent(eventType, eventAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to set %s event: %s", eventType, err)
+	}
+	return nil
+}
+
+// ===========================================================
+// getContractConfig reads the configuration stored by Init
+// ===========================================================
+func getContractConfig(stub shim.ChaincodeStubInterface) (*contractConfig, error) {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{"contract"})
+	if err != nil {
+		return nil, err
+	}
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get configuration: %s", err)
+	}
+
+	config := &contractConfig{IdentityStrategy: identity.StrategyMSPEnrollment}
+	if configAsBytes == nil {
+		return config, nil
+	}
+	err = json.Unmarshal(configAsBytes, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode configuration: %s", err)
+	}
+	return config, nil
+}
+
+// hasContractConfig reports whether a configuration is stored
+func hasContractConfig(stub shim.ChaincodeStubInterface) (bool, error) {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{"contract"})
+	if err != nil {
+		return false, err
+	}
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get configuration: %s", err)
+	}
+	return configAsBytes != nil, nil
+}
+
+// ===========================================================
+// parseContractConfig decodes and validates a configuration document
+// ===========================================================
+func parseContractConfig(configJSON string) (*contractConfig, error) {
+	config := &contractConfig{}
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode configuration JSON: %s", err)
+	}
+
+	if _, err = identity.NewResolver(config.identityConfig()); err != nil {
+		return nil, err
+	}
+	for _, mspId := range append(append([]string{}, config.AdminMSPs...), config.EmployerMSPs...) {
+		if strings.TrimSpace(mspId) == "" {
+			return nil, fmt.Errorf("adminMSPs and employerMSPs must not hold empty MSP IDs")
+		}
+	}
+	if config.DateFormat != "" {
+		if err = workdate.CheckLayout(config.DateFormat); err != nil {
+			return nil, fmt.Errorf("Invalid dateFormat: %s", err)
+		}
+	}
+	if _, err = config.location(); err != nil {
+		return nil, err
+	}
+	if config.MaxWorksBatchSize < 0 || config.MaxWorksBatchSize > batchSizeLimit {
+		return nil, fmt.Errorf("maxWorksBatchSize must be between 1 and %d, or 0 for the default", batchSizeLimit)
+	}
+	if config.MaxMigrationBatchSize < 0 || config.MaxMigrationBatchSize > batchSizeLimit {
+		return nil, fmt.Errorf("maxMigrationBatchSize must be between 1 and %d, or 0 for the default", batchSizeLimit)
+	}
+	if config.OverlapPolicy != "" && config.OverlapPolicy != overlapReject && config.OverlapPolicy != overlapFlag {
+		return nil, fmt.Errorf("overlapPolicy must be %s or %s", overlapReject, overlapFlag)
+	}
+	for feature := range config.Features {
+		if !containsString(knownFeatures, feature) {
+			return nil, fmt.Errorf("Unknown feature %s, expecting one of %s", feature, strings.Join(knownFeatures, ", "))
+		}
+	}
+	return config, nil
+}
+
+// ===========================================================
+// putContractConfig stores config as the next version of the
+// configuration and keeps a copy in the configuration history
+// ===========================================================
+func putContractConfig(stub shim.ChaincodeStubInterface, config *contractConfig) error {
+	current, err := getContractConfig(stub)
+	if err != nil {
+		return err
+	}
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return err
+	}
+	// name the caller the way the new configuration would
+	resolver, err := identity.NewResolver(config.identityConfig())
+	if err != nil {
+		return err
+	}
+	config.UpdatedBy, err = resolver.Resolve(caller)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve caller name: %s", err)
+	}
+	config.Version = current.Version + 1
+	config.TxId = stub.GetTxID()
+
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{"contract"})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(configKey, configJSONasBytes)
+	if err != nil {
+		return err
+	}
+	historyKey, err := stub.CreateCompositeKey(configHistoryIndex, []string{fmt.Sprintf("%010d", config.Version)})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(historyKey, configJSONasBytes)
+}
+
+// ===========================================================
+// resolveCallerName names the caller with the configured resolver
+// ===========================================================
+func resolveCallerName(stub shim.ChaincodeStubInterface, caller *identity.Caller) (string, error) {
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	resolver, err := identity.NewResolver(config.identityConfig())
+	if err != nil {
+		return "", err
+	}
+	name, err := resolver.Resolve(caller)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve caller name: %s", err)
+	}
+	return name, nil
+}
+
+// ===========================================================
+// reviewWork moves a pending work to verified or rejected.
+// Only the employer org named on the work may review it.
+// ===========================================================
+func (t *SimpleChaincode) reviewWork(stub shim.ChaincodeStubInterface, workId string, newStatus string, reason string) pb.Response {
+	fmt.Println("- start reviewWork ", workId, newStatus)
+
+	workAsBytes, err := stub.GetState(workId)
+	if err != nil {
+		return shim.Error("Failed to get work:" + err.Error())
+	} else if workAsBytes == nil {
+		return shim.Error("Work does not exist")
+	}
+
+	workToReview := work{}
+	err = workrecord.Decode(workId, workAsBytes, &workToReview)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	caller, err := authorize(stub, roleEmployer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if caller.MSPID != workToReview.Employer {
+		return shim.Error("Only the employer org " + workToReview.Employer + " may review work " + workId)
+	}
+	reviewer, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if workToReview.Status != statusPending {
+		return shim.Error("Work " + workId + " is " + workToReview.Status + ", only pending works can be reviewed")
+	}
+
+	workToReview.Status = newStatus
+	workToReview.Reviewer = reviewer
+	workToReview.ReviewReason = reason
+
+	workJSONasBytes, _ := json.Marshal(workToReview)
+	err = workIndexes.PutState(stub, workId, workJSONasBytes) //rewrite the work and move its index entries
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the first write of the employer binds later changes to its endorsement
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policy, err := stub.GetStateValidationParameter(workId)
+	if err != nil {
+		return shim.Error("Failed to get endorsement policy: " + err.Error())
+	}
+	if len(policy) > 0 {
+		err = putWorkEndorsementPolicy(stub, workId, workJSONasBytes, policy)
+	} else if config.featureEnabled(featureKeyPolicies) {
+		err = setWorkEndorsementOrgs(stub, workId, workJSONasBytes, []string{caller.MSPID})
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eventType := eventWorkAttested
+	if newStatus == statusRejected {
+		eventType = eventWorkRejected
+	}
+	err = setWorkEvent(stub, eventType, &workToReview, reviewer, []string{"status", "reviewer", "reviewReason"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end reviewWork (success)")
+	return shim.Success(nil)
+}
+
+// ===========================================================================================
+// getWorkEndorsementPolicy lists the orgs whose peers must endorse changes to a work.
+// reviewWork sets the policy to the employer org on its first review of the work.
+// The policy covers the work, its index entries and, for a private work, its private
+// details, so every transaction writing any of them needs the endorsement of these orgs.
+// Only admins may inspect the policies.
+// ===========================================================================================
+func (t *SimpleChaincode) getWorkEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "workId"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	workId := args[0]
+
+	_, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	orgs, err := getWorkEndorsementOrgs(stub, workId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policyAsBytes, err := json.Marshal(workEndorsementPolicy{WorkId: workId, Orgs: orgs})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(policyAsBytes)
+}
+
+// ===========================================================================================
+// setWorkEndorsementPolicy replaces the orgs whose peers must endorse changes to a work,
+// e.g. when the employer org moves to another MSP. Fabric validates the change against
+// the current policy, so the transaction needs the endorsement of the current orgs too.
+// Only admins may change the policies.
+// ===========================================================================================
+func (t *SimpleChaincode) setWorkEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1
+	// "workId", "Org2MSP,Org3MSP"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	workId := args[0]
+	orgs := parseOrgs(args[1])
+	if len(orgs) == 0 {
+		return shim.Error("2nd argument must list at least one MSP ID")
+	}
+
+	_, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	workAsBytes, err := stub.GetState(workId)
+	if err != nil {
+		return shim.Error("Failed to get work:" + err.Error())
+	} else if workAsBytes == nil {
+		return shim.Error("Work does not exist: " + workId)
+	}
+
+	err = setWorkEndorsementOrgs(stub, workId, workAsBytes, orgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policyAsBytes, err := json.Marshal(workEndorsementPolicy{WorkId: workId, Orgs: orgs})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(policyAsBytes)
+}
+
+// getWorkEndorsementOrgs returns the orgs of the key-level endorsement policy of a work
+func getWorkEndorsementOrgs(stub shim.ChaincodeStubInterface, workId string) ([]string, error) {
+	policy, err := stub.GetStateValidationParameter(workId)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get endorsement policy: %s", err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+	ep, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode endorsement policy: %s", err)
+	}
+	orgs := ep.ListOrgs()
+	sort.Strings(orgs)
+	return orgs, nil
+}
+
+// parseOrgs splits a comma separated list of MSP IDs
+func parseOrgs(arg string) []string {
+	var orgs []string
+	for _, org := range strings.Split(arg, ",") {
+		if org = strings.TrimSpace(org); org != "" {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// setWorkEndorsementOrgs requires the peers of every given org to endorse changes to a work
+// stored as value, see putWorkEndorsementPolicy
+func setWorkEndorsementOrgs(stub shim.ChaincodeStubInterface, workId string, value []byte, orgs []string) error {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = ep.AddOrgs(statebased.RoleTypePeer, orgs...)
+	if err != nil {
+		return fmt.Errorf("Failed to build endorsement policy: %s", err)
+	}
+	policy, err := ep.Policy()
+	if err != nil {
+		return fmt.Errorf("Failed to build endorsement policy: %s", err)
+	}
+	return putWorkEndorsementPolicy(stub, workId, value, policy)
+}
+
+// putWorkEndorsementPolicy sets policy on the work key, on the index entries of the work
+// stored as value and, for a private work, on its private details. Without it the
+// entries and the details would stay under the chaincode-level policy.
+func putWorkEndorsementPolicy(stub shim.ChaincodeStubInterface, workId string, value []byte, policy []byte) error {
+	err := stub.SetStateValidationParameter(workId, policy)
+	if err != nil {
+		return fmt.Errorf("Failed to set endorsement policy: %s", err)
+	}
+	for _, index := range workIndexes.Indexes() {
+		indexKey, ok, err := workIndexes.EntryKey(stub, index, value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = stub.SetStateValidationParameter(indexKey, policy)
+		if err != nil {
+			return fmt.Errorf("Failed to set endorsement policy of index entry: %s", err)
+		}
+	}
+	var w work
+	err = workrecord.Decode(workId, value, &w)
+	if err != nil {
+		return err
+	}
+	if w.Hash != "" {
+		err = stub.SetPrivateDataValidationParameter(collectionWorkPrivateDetails, workId, policy)
+		if err != nil {
+			return fmt.Errorf("Failed to set endorsement policy of private details: %s", err)
+		}
+	}
+	return nil
+}
+
+// keepWorkEndorsementPolicy extends the policy of a work to the index entries of its new
+// value. Fabric drops the policy of a deleted key, so entries moved by workIndexes.PutState
+// would otherwise fall back to the chaincode-level policy.
+func keepWorkEndorsementPolicy(stub shim.ChaincodeStubInterface, workId string, value []byte) error {
+	policy, err := stub.GetStateValidationParameter(workId)
+	if err != nil {
+		return fmt.Errorf("Failed to get endorsement policy: %s", err)
+	}
+	if len(policy) == 0 {
+		return nil
+	}
+	return putWorkEndorsementPolicy(stub, workId, value, policy)
+}
+
+// ===========================================================================================
+// getWorksByRange performs a range query based on the start and end keys provided.
+
+// Read-only function results are not typically submitted to ordering. If the read-only
+// results are submitted to ordering, or if the query is used in an update transaction
+// and submitted to ordering, then the committing peers will re-execute to guarantee that
+// result sets are stable between endorsement time and commit time. The transaction is
+// invalidated by the committing peers if the result set has changed between endorsement
+// time and commit time.
+// Therefore, range queries are a safe option for performing update transactions based on query results.
+// ===========================================================================================
+func (t *SimpleChaincode) getWorksByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1         2
+	// "startKey", "endKey", "true"
+	if len(args) < 2 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	startKey := args[0]
+	endKey := args[1]
+	includeRevoked := false
+	if len(args) == 3 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a boolean string")
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	buffer, err := constructQueryResponseFromIterator(resultsIterator, includeRevoked, access)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("- getWorksByRange queryResult:\n%s\n", buffer.String())
+
+	return shim.Success(buffer.Bytes())
+}
+
+// ====== Pagination =========================================================================
+// Pagination provides a method to retrieve records with a defined pagesize and
+// start point (bookmark). An empty string bookmark defines the first "page" of a query
+// result. Paginated queries return a bookmark that can be used in
+// the next query to retrieve the next page of results. Paginated queries extend
+// rich queries and range queries to include a pagesize and bookmark.
+//
+// Paginated queries are only valid for read only transactions.
+// ===========================================================================================
+
+// ===========================================================================================
+// getWorksByRangeWithPagination performs a range query based on the start & end key,
+// page size and a bookmark.
+// The number of fetched records will be equal to or lesser than the page size.
+// The response carries the records plus a ResponseMetadata block with the fetched
+// count and the bookmark to pass in for the next page.
+// ===========================================================================================
+func (t *SimpleChaincode) getWorksByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1         2          3        4
+	// "startKey", "endKey", "3", "bookmark", "true"
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 to 5")
+	}
+
+	startKey := args[0]
+	endKey := args[1]
+	pageSize, err := strconv.ParseInt(args[2], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("3rd argument must be a positive numeric string")
+	}
+	bookmark := ""
+	if len(args) >= 4 {
+		bookmark = args[3]
+	}
+	includeRevoked := false
+	if len(args) == 5 {
+		includeRevoked, err = strconv.ParseBool(args[4])
+		if err != nil {
+			return shim.Error("5th argument must be a boolean string")
+		}
+	}
+
+	resultsIterator, responseMetadata, err := stub.GetStateByRangeWithPagination(startKey, endKey, int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	buffer, err := constructQueryResponseFromIterator(resultsIterator, includeRevoked, access)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+
+	fmt.Printf("- getWorksByRangeWithPagination: %d works, bookmark %s\n", responseMetadata.FetchedRecordsCount, responseMetadata.Bookmark)
+
+	return shim.Success(bufferWithPaginationInfo.Bytes())
+}
+
+// ===========================================================================================
+// getConflictsForUid lists the pairs of works of a uid whose periods overlap. Only the
+// later filed work of a pair is marked conflicting, see checkWorkOverlaps, so this is
+// where the earlier one shows its conflicts.
+// Revoked and rejected works do not claim a period and are left out,
+// so are works without valid dates.
+// ===========================================================================================
+func (t *SimpleChaincode) getConflictsForUid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "uid"
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(args[0], "", scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		return shim.Error(access.caller.MSPID + " has no active grant to read the works of uid " + args[0])
+	}
+
+	works, err := getWorksForUid(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	conflicts := []workConflict{}
+	for i, w := range works {
+		if !workrecord.ClaimsPeriod(w) {
+			continue
+		}
+		_, end, _ := workrecord.Period(w)
+		// works are ordered by start, the ones starting after w ends can not overlap it
+		for _, other := range works[i+1:] {
+			otherStart, _, _ := workrecord.Period(other)
+			if !otherStart.Before(end) {
+				break
+			}
+			if !workrecord.ClaimsPeriod(other) || !workrecord.Overlap(w, other) {
+				continue
+			}
+			conflicts = append(conflicts, newWorkConflict(w, other))
+		}
+	}
+
+	conflictsAsBytes, err := json.Marshal(conflicts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(conflictsAsBytes)
+}
+
+// ===========================================================================================
+// getWorksByUid returns the works of a uid, or of a uid at one employer.
+// Uses a GetStateByPartialCompositeKey against the uid~employer~workId index,
+// so it behaves the same on LevelDB and CouchDB.
+// Revoked works are left out unless the optional last argument is "true".
+// ===========================================================================================
+func (t *SimpleChaincode) getWorksByUid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1          2
+	// "uid", "Org2MSP", "true"
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 to 3")
+	}
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	attributes := []string{args[0]}
+	if len(args) > 1 && args[1] != "" {
+		attributes = append(attributes, args[1])
+	}
+	includeRevoked := false
+	if len(args) == 3 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a boolean string")
+		}
+	}
+
+	buffer, err := getWorksByIndex(stub, uidEmployerIndex, attributes, includeRevoked)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(buffer.Bytes())
+}
+
+// ===========================================================================================
+// getWorksByEmployer returns the works of an employer MSP ID, or of one uid at the employer.
+// Uses a GetStateByPartialCompositeKey against the employer~uid~workId index,
+// so it behaves the same on LevelDB and CouchDB.
+// Revoked works are left out unless the optional last argument is "true".
+// ===========================================================================================
+func (t *SimpleChaincode) getWorksByEmployer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1      2
+	// "Org2MSP", "uid", "true"
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 to 3")
+	}
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	attributes := []string{args[0]}
+	if len(args) > 1 && args[1] != "" {
+		attributes = append(attributes, args[1])
+	}
+	includeRevoked := false
+	if len(args) == 3 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a boolean string")
+		}
+	}
+
+	buffer, err := getWorksByIndex(stub, employerUidIndex, attributes, includeRevoked)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(buffer.Bytes())
+}
+
+// ===========================================================================================
+// getWorksByIndex looks up the works of the index entries matching the partial key
+// and writes them like constructQueryResponseFromIterator does, works the caller
+// has no grant to read are skipped
+// ===========================================================================================
+func getWorksByIndex(stub shim.ChaincodeStubInterface, indexName string, attributes []string, includeRevoked bool) (*bytes.Buffer, error) {
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(indexName, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing QueryResults
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		returnedWorkId := compositeKeyParts[len(compositeKeyParts)-1]
+
+		workAsBytes, err := stub.GetState(returnedWorkId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get work %s: %s", returnedWorkId, err)
+		} else if workAsBytes == nil {
+			continue
+		}
+		if !includeRevoked {
+			var record struct {
+				Status string `json:"status"`
+			}
+			if json.Unmarshal(workAsBytes, &record) == nil && record.Status == statusRevoked {
+				continue
+			}
+		}
+		allowed, err := access.allowedRecord(workAsBytes, scopeWorks)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"Key\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(returnedWorkId)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Record\":")
+		// Record is a JSON object, so we write as-is
+		buffer.WriteString(string(workAsBytes))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return &buffer, nil
+}
+
+// ===========================================================================================
+// getTimelineForUid returns the works of a uid ordered by workstartdate, together with
+// the gaps between them, the total tenure, the tenure per employer and the current employer,
+// see workrecord.Timeline. Revoked works are left out unless the optional second argument
+// is "true". Only verified works count for gaps, tenure and the current employer, the days
+// claimed by pending works are reported apart. The current employer is the one whose work
+// covers the transaction time. Private works have no dates on the public record and no
+// uid~workstartdate~workId entry, they are listed in privateWorks without being placed
+// on the timeline.
+// Built on composite key indexes, so it works on LevelDB as well as CouchDB.
+// ===========================================================================================
+func (t *SimpleChaincode) getTimelineForUid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1
+	// "uid", "true"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+	uid := args[0]
+	includeRevoked := false
+	if len(args) == 2 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[1])
+		if err != nil {
+			return shim.Error("2nd argument must be a boolean string")
+		}
+	}
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed, err := access.allowed(uid, "", scopeWorks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !allowed {
+		return shim.Error(access.caller.MSPID + " has no active grant to read the works of uid " + uid)
+	}
+
+	works, err := getWorksForUid(stub, uid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error("Failed to get tx timestamp:" + err.Error())
+	}
+	now := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC()
+
+	timeline := workrecord.NewTimeline(uid, works, now, includeRevoked)
+	timeline.PrivateWorks, err = getPrivateWorksForUid(stub, uid, includeRevoked)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	timelineAsBytes, err := json.Marshal(timeline)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(timelineAsBytes)
+}
+
 // ===========================================================================================
-// getWorksByRange performs a range query based on the start and end keys provided.
-
-// Read-only function results are not typically submitted to ordering. If the read-only
-// results are submitted to ordering, or if the query is used in an update transaction
-// and submitted to ordering, then the committing peers will re-execute to guarantee that
-// result sets are stable between endorsement time and commit time. The transaction is
-// invalidated by the committing peers if the result set has changed between endorsement
-// time and commit time.
-// Therefore, range queries are a safe option for performing update transactions based on query results.
+// getWorksForUid returns the works of a uid with valid dates, ordered by workstartdate.
+// It walks the uid~workstartdate~workId index, so it behaves the same on LevelDB and CouchDB.
 // ===========================================================================================
-func (t *SimpleChaincode) getWorksByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+func getWorksForUid(stub shim.ChaincodeStubInterface, uid string) ([]*work, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(uidStartIndex, []string{uid})
+	if err != nil {
+		return nil, err
 	}
+	defer resultsIterator.Close()
 
-	startKey := args[0]
-	endKey := args[1]
+	var works []*work
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		returnedWorkId := compositeKeyParts[len(compositeKeyParts)-1]
 
-	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+		workAsBytes, err := stub.GetState(returnedWorkId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get work %s: %s", returnedWorkId, err)
+		} else if workAsBytes == nil {
+			continue
+		}
+		record := &work{}
+		err = workrecord.Decode(returnedWorkId, workAsBytes, record)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode JSON of %s: %s", returnedWorkId, err)
+		}
+		if _, _, ok := workrecord.Period(record); !ok {
+			continue
+		}
+		works = append(works, record)
+	}
+	return works, nil
+}
+
+// getPrivateWorksForUid returns the works of a uid filed with initWorkPrivate. Their dates
+// are not on the public record, so they are found through the uid~employer~workId index.
+// Revoked works are left out unless includeRevoked is set.
+func getPrivateWorksForUid(stub shim.ChaincodeStubInterface, uid string, includeRevoked bool) ([]*work, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(uidEmployerIndex, []string{uid})
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	// buffer is a JSON array containing QueryResults
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
+	works := []*work{}
 	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+		responseRange, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return nil, err
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
 		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
+		returnedWorkId := compositeKeyParts[len(compositeKeyParts)-1]
 
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		workAsBytes, err := stub.GetState(returnedWorkId)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get work %s: %s", returnedWorkId, err)
+		} else if workAsBytes == nil {
+			continue
+		}
+		record := &work{}
+		err = workrecord.Decode(returnedWorkId, workAsBytes, record)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode JSON of %s: %s", returnedWorkId, err)
+		}
+		if record.Hash == "" || (!includeRevoked && record.Status == statusRevoked) {
+			continue
+		}
+		works = append(works, record)
 	}
-	buffer.WriteString("]")
+	return works, nil
+}
 
-	fmt.Printf("- getWorksByRange queryResult:\n%s\n", buffer.String())
+// checkWorkOverlaps compares the period of a new work w with the other works of its uid
+// in state. Under the reject policy an overlap is an error. Under the flag policy w is
+// marked conflicting with the works it overlaps. Those are not rewritten: they may be
+// attested, and bound to the endorsement of their employer, so a candidate's filing
+// could neither change them nor pass validation without that employer.
+// getConflictsForUid lists the overlapping pairs from both sides.
+func checkWorkOverlaps(stub shim.ChaincodeStubInterface, config *contractConfig, w *work) error {
+	if _, _, ok := workrecord.Period(w); !ok {
+		return nil
+	}
 
-	return shim.Success(buffer.Bytes())
+	works, err := getWorksForUid(stub, w.CandidateUid)
+	if err != nil {
+		return err
+	}
+	overlapped := workrecord.Overlapping(w, works)
+	if len(overlapped) == 0 {
+		return nil
+	}
+	if config.overlapPolicy() == overlapReject {
+		var overlapping []string
+		for _, other := range overlapped {
+			overlapping = append(overlapping, other.WorkId)
+		}
+		return fmt.Errorf("Work %s overlaps works %s of the same uid", w.WorkId, strings.Join(overlapping, ", "))
+	}
+	for _, other := range overlapped {
+		workrecord.FlagConflict(w, other.WorkId)
+	}
+	return nil
+}
+
+func newWorkConflict(a *work, b *work) workConflict {
+	aStart, aEnd, _ := workrecord.Period(a)
+	bStart, bEnd, _ := workrecord.Period(b)
+	start, end := aStart, aEnd
+	if bStart.After(start) {
+		start = bStart
+	}
+	if bEnd.Before(end) {
+		end = bEnd
+	}
+	return workConflict{
+		WorkId:       a.WorkId,
+		OtherWorkId:  b.WorkId,
+		OverlapStart: workdate.Format(start),
+		OverlapEnd:   workdate.Format(end),
+		Flagged:      containsString(a.ConflictsWith, b.WorkId) || containsString(b.ConflictsWith, a.WorkId),
+	}
 }
 
 // ==== Example: GetStateByPartialCompositeKey/RangeQuery =========================================
 // transferWorksBasedOnWorkstartdate will transfer works of a given workstartdate to a certain new workexperience.
-// Uses a GetStateByPartialCompositeKey (range query) against workstartdate~uid 'index'.
+// Only the works of the uids the caller is the data subject of are transferred.
+// Uses a GetStateByPartialCompositeKey (range query) against workstartdate~workId 'index'.
 // Committing peers will re-execute range queries to guarantee that result sets are stable
 // between endorsement time and commit time. The transaction is invalidated by the
 // committing peers if the result set has changed between endorsement time and commit time.
@@ -391,48 +3474,510 @@ func (t *SimpleChaincode) transferWorksBasedOnWorkstartdate(stub shim.ChaincodeS
 		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
-	workstartdate := args[0]
-	newWorkexperience := strings.ToLower(args[1])
-	fmt.Println("- start transferWorksBasedOnWorkstartdate ", workstartdate, newWorkexperience)
+	workstartdate := args[0]
+	newWorkexperience := strings.ToLower(args[1])
+	fmt.Println("- start transferWorksBasedOnWorkstartdate ", workstartdate, newWorkexperience)
+
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !config.featureEnabled(featureTransfers) {
+		return shim.Error("Transfers are disabled by the contract configuration")
+	}
+	caller, err := authorize(stub, roleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actor, err := resolveCallerName(stub, caller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the index holds the stored form of the date, a date given in that form is taken
+	// as stored. Works filed before dates were validated may hold anything and are
+	// matched as given
+	if date, err := config.parseStoredWorkDate(workstartdate); err == nil {
+		workstartdate = workdate.Format(date)
+	}
+
+	// Query the workstartdate~workId index by workstartdate
+	// This will execute a key range query on all keys starting with 'workstartdate'
+	workstartdateedWorkResultsIterator, err := stub.GetStateByPartialCompositeKey(startIndex, []string{workstartdate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer workstartdateedWorkResultsIterator.Close()
+
+	// Iterate through result set and for each work found, transfer to newWorkexperience
+	var transferredWorkIds []string
+	for workstartdateedWorkResultsIterator.HasNext() {
+		// Note that we don't get the value (2nd return variable), we'll just get the work uid from the composite key
+		responseRange, err := workstartdateedWorkResultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// get the workstartdate and workId from workstartdate~workId composite key
+		objectType, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		returnedWorkstartdate := compositeKeyParts[0]
+		returnedWorkId := compositeKeyParts[1]
+		fmt.Printf("- found a work from index:%s workstartdate:%s workId:%s\n", objectType, returnedWorkstartdate, returnedWorkId)
+
+		// revoked works keep their index entries but are left alone, as are
+		// the works of other candidates
+		record, err := getWorkRecord(stub, returnedWorkId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if record == nil || record.Status == statusRevoked {
+			continue
+		}
+		subject, err := getDataSubject(stub, record.CandidateUid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if subject == nil || subject.Subject != actor {
+			continue
+		}
+
+		// Now call the transfer function for the found work.
+		// Re-use the same function that is used to transfer individual works
+		response := t.transferWork(stub, []string{returnedWorkId, newWorkexperience})
+		// if the transfer failed break out of loop and return error
+		if response.Status != shim.OK {
+			return shim.Error("Transfer failed: " + response.Message)
+		}
+		transferredWorkIds = append(transferredWorkIds, returnedWorkId)
+	}
+
+	// each transferWork replaced the event of the one before, emit one for all of them
+	if len(transferredWorkIds) > 0 {
+		event := workEvent{
+			Type:          eventWorkTransferred,
+			WorkIds:       transferredWorkIds,
+			Actor:         actor,
+			TxId:          stub.GetTxID(),
+			ChangedFields: []string{"workexperience", "status", "reviewer", "reviewReason"},
+		}
+		eventAsBytes, err := json.Marshal(event)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.SetEvent(eventWorkTransferred, eventAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	responsePayload := fmt.Sprintf("Transferred %d %s works to %s", len(transferredWorkIds), workstartdate, newWorkexperience)
+	fmt.Println("- end transferWorksBasedOnWorkstartdate: " + responsePayload)
+	return shim.Success([]byte(responsePayload))
+}
+
+// ===========================================================================================
+// rebuildIndexes adds the missing entries of an index, one chunk of works per call.
+// Pass the bookmark returned by a call to the next one until it comes back empty.
+// Paginated queries can not be used in update transactions, so the bookmark is
+// the key of the last work scanned.
+// Only admins may rebuild indexes.
+// ===========================================================================================
+func (t *SimpleChaincode) rebuildIndexes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0                       1
+	// "workstartdate~workId", "bookmark"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+
+	index, ok := workIndexes.Index(args[0])
+	if !ok {
+		return shim.Error("Unknown index " + args[0])
+	}
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+
+	_, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result := indexRebuildResult{IndexName: index.Name, Added: []indexEntry{}}
+	result.Bookmark, result.WorksScanned, err = scanWorks(stub, bookmark, indexScanChunkSize, func(workId string, value []byte) error {
+		indexKey, added, err := workIndexes.EnsureEntry(stub, index, value)
+		if err != nil || !added {
+			return err
+		}
+		// the restored entry is a new key, only the policy of the work must be put on it
+		policy, err := stub.GetStateValidationParameter(workId)
+		if err != nil {
+			return fmt.Errorf("Failed to get endorsement policy: %s", err)
+		}
+		if len(policy) > 0 {
+			err = stub.SetStateValidationParameter(indexKey, policy)
+			if err != nil {
+				return fmt.Errorf("Failed to set endorsement policy of index entry: %s", err)
+			}
+		}
+		_, attributes, err := stub.SplitCompositeKey(indexKey)
+		if err != nil {
+			return err
+		}
+		result.Added = append(result.Added, indexEntry{WorkId: workId, Attributes: attributes})
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("- rebuildIndexes %s: %d works scanned, %d entries added\n", result.IndexName, result.WorksScanned, len(result.Added))
+	return shim.Success(resultAsBytes)
+}
+
+// ===========================================================================================
+// verifyIndexes reports works missing from an index and index entries that point to
+// a work that does not exist or no longer matches them, one chunk per call.
+// It scans the works first and the index entries second. Pass the bookmark returned by
+// a call to the next one until it comes back empty.
+// Only admins may verify indexes.
+// ===========================================================================================
+func (t *SimpleChaincode) verifyIndexes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0                       1
+	// "workstartdate~workId", "bookmark"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+
+	index, ok := workIndexes.Index(args[0])
+	if !ok {
+		return shim.Error("Unknown index " + args[0])
+	}
+	bookmark := indexPhaseRecords
+	if len(args) == 2 && args[1] != "" {
+		bookmark = args[1]
+	}
+
+	_, err := authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result := indexVerifyResult{IndexName: index.Name, Missing: []indexEntry{}, Orphaned: []indexEntry{}}
+
+	if strings.HasPrefix(bookmark, indexPhaseRecords) {
+		var next string
+		next, result.Scanned, err = scanWorks(stub, strings.TrimPrefix(bookmark, indexPhaseRecords), indexScanChunkSize, func(workId string, value []byte) error {
+			indexKey, present, err := workIndexes.HasEntry(stub, index, value)
+			if err != nil || present {
+				return err
+			}
+			_, attributes, err := stub.SplitCompositeKey(indexKey)
+			if err != nil {
+				return err
+			}
+			result.Missing = append(result.Missing, indexEntry{WorkId: workId, Attributes: attributes})
+			return nil
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		result.Bookmark = indexPhaseRecords + next
+		if next == "" {
+			result.Bookmark = indexPhaseEntries
+		}
+	} else if strings.HasPrefix(bookmark, indexPhaseEntries) {
+		resultsIterator, responseMetadata, err := stub.GetStateByPartialCompositeKeyWithPagination(index.Name, []string{},
+			indexScanChunkSize, strings.TrimPrefix(bookmark, indexPhaseEntries))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer resultsIterator.Close()
+
+		for resultsIterator.HasNext() {
+			responseRange, err := resultsIterator.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			result.Scanned++
+			orphaned, err := workIndexes.IsOrphaned(stub, index, responseRange.Key)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if !orphaned {
+				continue
+			}
+			_, attributes, err := stub.SplitCompositeKey(responseRange.Key)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			entry := indexEntry{Attributes: attributes}
+			if len(attributes) > 0 {
+				entry.WorkId = attributes[len(attributes)-1]
+			}
+			result.Orphaned = append(result.Orphaned, entry)
+		}
+		// a short page is the last one
+		if responseMetadata.FetchedRecordsCount >= indexScanChunkSize {
+			result.Bookmark = indexPhaseEntries + responseMetadata.Bookmark
+		}
+	} else {
+		return shim.Error("Invalid bookmark " + bookmark)
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("- verifyIndexes %s: %d scanned, %d missing, %d orphaned\n", result.IndexName, result.Scanned, len(result.Missing), len(result.Orphaned))
+	return shim.Success(resultAsBytes)
+}
+
+// ===========================================================================================
+// scanWorks calls visit for up to limit works stored after the key in bookmark.
+// It returns the key to resume from, empty once the last work was visited, and the
+// number of works visited. Index entries and other composite keys are not part of the range.
+// ===========================================================================================
+func scanWorks(stub shim.ChaincodeStubInterface, bookmark string, limit int, visit func(workId string, value []byte) error) (string, int, error) {
+	startKey := ""
+	if bookmark != "" {
+		startKey = bookmark + "\x00" //the smallest key after the bookmark
+	}
+
+	resultsIterator, err := stub.GetStateByRange(startKey, "")
+	if err != nil {
+		return "", 0, err
+	}
+	defer resultsIterator.Close()
+
+	scanned := 0
+	lastKey := ""
+	for resultsIterator.HasNext() && scanned < limit {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", 0, err
+		}
+		err = visit(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return "", 0, err
+		}
+		scanned++
+		lastKey = queryResponse.Key
+	}
+	if !resultsIterator.HasNext() {
+		return "", scanned, nil
+	}
+	return lastKey, scanned, nil
+}
+
+// ===========================================================================================
+// migrateWorks rewrites works stored in an old layout in the current one, one page
+// of batchSize works per call. The progress is kept in state: pass an empty bookmark
+// to continue where the last call stopped, or the key of a work to continue after it.
+// Works that can not be read are reported and left as they are. Works in the baseline
+// layout also lose their workstartdate~uid index entry, see workrecord. A uid not yet
+// bound to a data subject is bound to the claimant of its first migrated work.
+//
+// A work bound to a key-level endorsement policy, see getWorkEndorsementPolicy, can only
+// be rewritten with the endorsement of the orgs of its policy. Admins migrate in passes:
+// a pass without the optional third argument migrates the unbound works and reports the
+// bound ones as skipped. A pass with a list of MSP IDs migrates the works whose policy
+// lists only these orgs; its proposal must be sent to peers of each of them as well as
+// to the peers the chaincode-level policy needs. Every pass keeps its own progress.
+// Only admins may migrate works.
+// ===========================================================================================
+func (t *SimpleChaincode) migrateWorks(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1       2
+	// "bookmark", "100", "Org2MSP,Org3MSP"
+	if len(args) < 2 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	var passOrgs []string
+	if len(args) == 3 {
+		passOrgs = parseOrgs(args[2])
+		if len(passOrgs) == 0 {
+			return shim.Error("3rd argument must list at least one MSP ID")
+		}
+	}
+	config, err := getContractConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batchSize, err := strconv.Atoi(args[1])
+	if err != nil || batchSize <= 0 || batchSize > config.maxMigrationBatchSize() {
+		return shim.Error(fmt.Sprintf("2nd argument must be a number between 1 and %d", config.maxMigrationBatchSize()))
+	}
+
+	_, err = authorize(stub, roleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	progress, err := getMigrationProgress(stub, passOrgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// a finished migration, or one to an older version, starts over
+	if progress.Done || progress.SchemaVersion != workSchemaVersion {
+		progress = &migrationProgress{SchemaVersion: workSchemaVersion, Orgs: progress.Orgs}
+	}
+	if args[0] != "" {
+		progress.Bookmark = args[0]
+	}
+
+	result := migrationResult{Migrated: []string{}, Failed: []migrationError{}, Skipped: []workEndorsementPolicy{}}
+	bound := make(map[string]bool) //state read in this transaction does not show its own writes
+	next, scanned, err := scanWorks(stub, progress.Bookmark, batchSize, func(workId string, value []byte) error {
+		if !workrecord.NeedsMigration(value) {
+			return nil
+		}
+		orgs, err := getWorkEndorsementOrgs(stub, workId)
+		if err != nil {
+			return err
+		}
+		for _, org := range orgs {
+			if !containsString(passOrgs, org) {
+				result.Skipped = append(result.Skipped, workEndorsementPolicy{WorkId: workId, Orgs: orgs})
+				return nil
+			}
+		}
+
+		var migrated work
+		err = workrecord.Decode(workId, value, &migrated)
+		if err != nil {
+			result.Failed = append(result.Failed, migrationError{WorkId: workId, Error: err.Error()})
+			return nil
+		}
+		err = workrecord.Migrate(stub, workId, value, &migrated)
+		if err != nil {
+			return err
+		}
+		if len(orgs) > 0 {
+			migratedAsBytes, err := json.Marshal(migrated)
+			if err != nil {
+				return err
+			}
+			err = keepWorkEndorsementPolicy(stub, workId, migratedAsBytes)
+			if err != nil {
+				return err
+			}
+		}
+		if migrated.CandidateUid != "" && migrated.Claimant != "" && !bound[migrated.CandidateUid] {
+			subject, err := getDataSubject(stub, migrated.CandidateUid)
+			if err != nil {
+				return err
+			}
+			if subject == nil {
+				err = bindDataSubject(stub, migrated.CandidateUid, migrated.Claimant)
+				if err != nil {
+					return err
+				}
+			}
+			bound[migrated.CandidateUid] = true
+		}
+		result.Migrated = append(result.Migrated, workId)
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result.Scanned = scanned
+	progress.Bookmark = next
+	progress.Done = next == ""
+	progress.Scanned += scanned
+	progress.Migrated += len(result.Migrated)
+	progress.TxId = stub.GetTxID()
+	err = putMigrationProgress(stub, passOrgs, progress)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	result.Progress = *progress
 
-	// Query the workstartdate~uid index by workstartdate
-	// This will execute a key range query on all keys starting with 'workstartdate'
-	workstartdateedWorkResultsIterator, err := stub.GetStateByPartialCompositeKey("workstartdate~uid", []string{workstartdate})
+	resultAsBytes, err := json.Marshal(result)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer workstartdateedWorkResultsIterator.Close()
+	fmt.Printf("- migrateWorks: %d scanned, %d migrated, %d failed, %d skipped\n", result.Scanned, len(result.Migrated), len(result.Failed), len(result.Skipped))
+	return shim.Success(resultAsBytes)
+}
 
-	// Iterate through result set and for each work found, transfer to newWorkexperience
-	var i int
-	for i = 0; workstartdateedWorkResultsIterator.HasNext(); i++ {
-		// Note that we don't get the value (2nd return variable), we'll just get the work uid from the composite key
-		responseRange, err := workstartdateedWorkResultsIterator.Next()
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+// ===========================================================================================
+// getWorkMigration returns the progress of the work migration, of the pass of the given
+// orgs if the optional argument lists them, see migrateWorks
+// ===========================================================================================
+func (t *SimpleChaincode) getWorkMigration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-		// get the workstartdate and uid from workstartdate~uid composite key
-		objectType, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		returnedWorkstartdate := compositeKeyParts[0]
-		returnedWorkUid := compositeKeyParts[1]
-		fmt.Printf("- found a work from index:%s workstartdate:%s uid:%s\n", objectType, returnedWorkstartdate, returnedWorkUid)
+	//   0
+	// "Org2MSP,Org3MSP"
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+	var passOrgs []string
+	if len(args) == 1 {
+		passOrgs = parseOrgs(args[0])
+	}
 
-		// Now call the transfer function for the found work.
-		// Re-use the same function that is used to transfer individual works
-		response := t.transferWork(stub, []string{returnedWorkUid, newWorkexperience})
-		// if the transfer failed break out of loop and return error
-		if response.Status != shim.OK {
-			return shim.Error("Transfer failed: " + response.Message)
-		}
+	progress, err := getMigrationProgress(stub, passOrgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	progressAsBytes, err := json.Marshal(progress)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	return shim.Success(progressAsBytes)
+}
 
-	responsePayload := fmt.Sprintf("Transferred %d %s works to %s", i, workstartdate, newWorkexperience)
-	fmt.Println("- end transferWorksBasedOnWorkstartdate: " + responsePayload)
-	return shim.Success([]byte(responsePayload))
+// getMigrationProgress reads the progress of the migration pass of the given orgs,
+// zero before the first run
+func getMigrationProgress(stub shim.ChaincodeStubInterface, orgs []string) (*migrationProgress, error) {
+	progressKey, err := migrationProgressKey(stub, orgs)
+	if err != nil {
+		return nil, err
+	}
+	progressAsBytes, err := stub.GetState(progressKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get migration progress: %s", err)
+	}
+	progress := &migrationProgress{Orgs: orgs}
+	if progressAsBytes == nil {
+		return progress, nil
+	}
+	err = json.Unmarshal(progressAsBytes, progress)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode migration progress: %s", err)
+	}
+	return progress, nil
+}
+
+func putMigrationProgress(stub shim.ChaincodeStubInterface, orgs []string, progress *migrationProgress) error {
+	progressKey, err := migrationProgressKey(stub, orgs)
+	if err != nil {
+		return err
+	}
+	progressAsBytes, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(progressKey, progressAsBytes)
+}
+
+// migrationProgressKey returns the key of the progress of the migration pass of the given
+// orgs. The pass without orgs keeps the key the migration had before passes.
+func migrationProgressKey(stub shim.ChaincodeStubInterface, orgs []string) (string, error) {
+	sorted := append([]string{}, orgs...)
+	sort.Strings(sorted)
+	return stub.CreateCompositeKey(migrationIndex, append([]string{"works"}, sorted...))
 }
 
 // =======Rich queries =========================================================================
@@ -456,17 +4001,25 @@ func (t *SimpleChaincode) transferWorksBasedOnWorkstartdate(stub shim.ChaincodeS
 // =========================================================================================
 func (t *SimpleChaincode) queryWorksByWorkexperience(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0
-	// "bob"
-	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	//   0       1
+	// "bob", "true"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
 	}
 
 	workexperience := strings.ToLower(args[0])
+	includeRevoked := false
+	if len(args) == 2 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[1])
+		if err != nil {
+			return shim.Error("2nd argument must be a boolean string")
+		}
+	}
 
 	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"work\",\"workexperience\":\"%s\"}}", workexperience)
 
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	queryResults, err := getQueryResultForQueryString(stub, queryString, includeRevoked)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -482,36 +4035,145 @@ func (t *SimpleChaincode) queryWorksByWorkexperience(stub shim.ChaincodeStubInte
 // =========================================================================================
 func (t *SimpleChaincode) queryWorks(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0
-	// "queryString"
-	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	//   0              1
+	// "queryString", "true"
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
 	}
 
 	queryString := args[0]
+	includeRevoked := false
+	if len(args) == 2 {
+		var err error
+		includeRevoked, err = strconv.ParseBool(args[1])
+		if err != nil {
+			return shim.Error("2nd argument must be a boolean string")
+		}
+	}
 
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	queryResults, err := getQueryResultForQueryString(stub, queryString, includeRevoked)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	return shim.Success(queryResults)
 }
 
+// ===== Example: Pagination with Parameterized Rich Query =================================
+// queryWorksByWorkexperienceWithPagination queries for works based on a passed in workexperience,
+// one page at a time. Pass the bookmark of the previous page to get the next one.
+// Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
-// getQueryResultForQueryString executes the passed in query string.
-// Result set is built and returned as a byte array containing the JSON results.
+func (t *SimpleChaincode) queryWorksByWorkexperienceWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0       1      2           3
+	// "bob", "3", "bookmark", "true"
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 to 4")
+	}
+
+	workexperience := strings.ToLower(args[0])
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+	bookmark := ""
+	if len(args) >= 3 {
+		bookmark = args[2]
+	}
+	includeRevoked := false
+	if len(args) == 4 {
+		includeRevoked, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return shim.Error("4th argument must be a boolean string")
+		}
+	}
+
+	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"work\",\"workexperience\":\"%s\"}}", workexperience)
+
+	queryResults, err := getQueryResultForQueryStringWithPagination(stub, queryString, int32(pageSize), bookmark, includeRevoked)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// ===== Example: Pagination with Ad hoc Rich Query ========================================
+// queryWorksWithPagination uses a query string, page size and a bookmark to perform a query
+// for works. Query string matching state database syntax is passed in and executed as is.
+// The number of fetched records would be equal to or lesser than the specified page size.
+// Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
-func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+func (t *SimpleChaincode) queryWorksWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	fmt.Printf("- getQueryResultForQueryString queryString:\n%s\n", queryString)
+	//   0              1      2           3
+	// "queryString", "3", "bookmark", "true"
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 to 4")
+	}
 
-	resultsIterator, err := stub.GetQueryResult(queryString)
+	queryString := args[0]
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+	bookmark := ""
+	if len(args) >= 3 {
+		bookmark = args[2]
+	}
+	includeRevoked := false
+	if len(args) == 4 {
+		includeRevoked, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return shim.Error("4th argument must be a boolean string")
+		}
+	}
+
+	queryResults, err := getQueryResultForQueryStringWithPagination(stub, queryString, int32(pageSize), bookmark, includeRevoked)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// =========================================================================================
+// getQueryResultForQueryStringWithPagination executes the passed in query string with
+// pagination info. Result set is built and returned as a byte array containing the JSON results.
+// Revoked works are dropped from the page unless includeRevoked is set, so a page may
+// hold fewer records than RecordsCount.
+// =========================================================================================
+func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string, includeRevoked bool) ([]byte, error) {
+
+	fmt.Printf("- getQueryResultForQueryStringWithPagination queryString:\n%s\n", queryString)
+
+	resultsIterator, responseMetadata, err := stub.GetQueryResultWithPagination(queryString, pageSize, bookmark)
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	// buffer is a JSON array containing QueryRecords
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return nil, err
+	}
+	buffer, err := constructQueryResponseFromIterator(resultsIterator, includeRevoked, access)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+
+	fmt.Printf("- getQueryResultForQueryStringWithPagination: %d records, bookmark %s\n", responseMetadata.FetchedRecordsCount, responseMetadata.Bookmark)
+
+	return bufferWithPaginationInfo.Bytes(), nil
+}
+
+// ===========================================================================================
+// constructQueryResponseFromIterator constructs a JSON array containing query results from
+// a given result iterator. Revoked works are skipped unless includeRevoked is set,
+// so are works the caller has no grant to read.
+// ===========================================================================================
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface, includeRevoked bool, access *accessChecker) (*bytes.Buffer, error) {
+	// buffer is a JSON array containing QueryResults
 	var buffer bytes.Buffer
 	buffer.WriteString("[")
 
@@ -521,6 +4183,21 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 		if err != nil {
 			return nil, err
 		}
+		if !includeRevoked {
+			var record struct {
+				Status string `json:"status"`
+			}
+			if json.Unmarshal(queryResponse.Value, &record) == nil && record.Status == statusRevoked {
+				continue
+			}
+		}
+		allowed, err := access.allowedRecord(queryResponse.Value, scopeWorks)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
@@ -538,22 +4215,89 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 	}
 	buffer.WriteString("]")
 
+	return &buffer, nil
+}
+
+// ===========================================================================================
+// addPaginationMetadataToQueryResults wraps the query results in a JSON object
+// together with the pagination metadata, e.g.
+// {"Records":[...], "ResponseMetadata":{"RecordsCount":3, "Bookmark":"..."}}
+// ===========================================================================================
+func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
+
+	var wrapped bytes.Buffer
+	wrapped.WriteString("{\"Records\":")
+	wrapped.Write(buffer.Bytes())
+
+	wrapped.WriteString(", \"ResponseMetadata\":{\"RecordsCount\":")
+	wrapped.WriteString(fmt.Sprintf("%v", responseMetadata.FetchedRecordsCount))
+	wrapped.WriteString(", \"Bookmark\":")
+	wrapped.WriteString(strconv.Quote(responseMetadata.Bookmark))
+	wrapped.WriteString("}}")
+
+	return &wrapped
+}
+
+// =========================================================================================
+// getQueryResultForQueryString executes the passed in query string.
+// Result set is built and returned as a byte array containing the JSON results.
+// =========================================================================================
+func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string, includeRevoked bool) ([]byte, error) {
+
+	fmt.Printf("- getQueryResultForQueryString queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return nil, err
+	}
+	buffer, err := constructQueryResponseFromIterator(resultsIterator, includeRevoked, access)
+	if err != nil {
+		return nil, err
+	}
+
 	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
 
 	return buffer.Bytes(), nil
 }
 
+// ===========================================================================================
+// getHistoryForWork returns every historical value of a work.
+// With "diff" as 2nd argument it returns only the changed fields per transaction instead,
+// see getHistoryDiffsForWork.
+// ===========================================================================================
 func (t *SimpleChaincode) getHistoryForWork(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	if len(args) < 1 {
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	workUid := args[0]
+	workId := args[0]
 
-	fmt.Printf("- start getHistoryForWork: %s\n", workUid)
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = access.checkWorkAccess(workId, scopeHistory)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(args) > 1 {
+		if args[1] != "diff" {
+			return shim.Error("Unknown history mode " + args[1] + ", expecting diff")
+		}
+		return t.getHistoryDiffsForWork(stub, workId, args[2:])
+	}
+
+	fmt.Printf("- start getHistoryForWork: %s\n", workId)
 
-	resultsIterator, err := stub.GetHistoryForKey(workUid)
+	resultsIterator, err := stub.GetHistoryForKey(workId)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -607,3 +4351,193 @@ func (t *SimpleChaincode) getHistoryForWork(stub shim.ChaincodeStubInterface, ar
 
 	return shim.Success(buffer.Bytes())
 }
+
+// ===========================================================================================
+// getWorkAsOf walks the history of a work and returns the version that was current
+// at the given instant, i.e. the last modification committed at or before it.
+// The history comes in commit order, so the walk stops at the first modification
+// stamped after the instant; the tx timestamps are not used to reorder it.
+// The instant is either RFC3339 ("2019-05-30T12:00:00Z") or unix seconds.
+// ===========================================================================================
+func (t *SimpleChaincode) getWorkAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0            1
+	// "workId", "2019-05-30T12:00:00Z"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	workId := args[0]
+	asOf, err := parseTimestampArg(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be an RFC3339 or unix timestamp: " + err.Error())
+	}
+
+	fmt.Printf("- start getWorkAsOf: %s %s\n", workId, asOf)
+
+	access, err := newAccessChecker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = access.checkWorkAccess(workId, scopeHistory)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(workId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	version := workVersion{WorkId: workId, AsOf: asOf.Format(time.RFC3339Nano), Value: json.RawMessage("null")}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		modified := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC()
+		if modified.After(asOf) {
+			break
+		}
+		version.Exists = true
+		version.IsDelete = response.IsDelete
+		version.TxId = response.TxId
+		version.Timestamp = modified.Format(time.RFC3339Nano)
+		if response.IsDelete {
+			version.Value = json.RawMessage("null")
+		} else {
+			version.Value = json.RawMessage(response.Value)
+		}
+	}
+
+	versionAsBytes, err := json.Marshal(version)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("- end getWorkAsOf: %s at tx %s\n", workId, version.TxId)
+
+	return shim.Success(versionAsBytes)
+}
+
+// parseTimestampArg accepts an RFC3339 timestamp or unix seconds
+func parseTimestampArg(arg string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.UTC(), nil
+}
+
+// ===========================================================================================
+// getHistoryDiffsForWork compares every historical value of a work with the one before it
+// and returns, per transaction, only the fields that changed.
+// Optional filters: from and to (RFC3339 or unix seconds, empty for unbounded) restrict
+// the time window, a comma separated field list restricts the fields reported.
+// ===========================================================================================
+func (t *SimpleChaincode) getHistoryDiffsForWork(stub shim.ChaincodeStubInterface, workId string, filters []string) pb.Response {
+
+	//   0       1        2
+	// "from", "to", "field1,field2"
+	if len(filters) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting at most from, to and fields")
+	}
+	var from, to time.Time
+	var err error
+	if len(filters) > 0 && filters[0] != "" {
+		from, err = parseTimestampArg(filters[0])
+		if err != nil {
+			return shim.Error("from must be an RFC3339 or unix timestamp: " + err.Error())
+		}
+	}
+	if len(filters) > 1 && filters[1] != "" {
+		to, err = parseTimestampArg(filters[1])
+		if err != nil {
+			return shim.Error("to must be an RFC3339 or unix timestamp: " + err.Error())
+		}
+	}
+	wantFields := map[string]bool{}
+	if len(filters) > 2 && filters[2] != "" {
+		for _, field := range strings.Split(filters[2], ",") {
+			wantFields[strings.TrimSpace(field)] = true
+		}
+	}
+
+	fmt.Printf("- start getHistoryDiffsForWork: %s\n", workId)
+
+	resultsIterator, err := stub.GetHistoryForKey(workId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	type modification struct {
+		txId     string
+		modified time.Time
+		isDelete bool
+		fields   map[string]json.RawMessage
+	}
+	var modifications []modification
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fields := map[string]json.RawMessage{}
+		if !response.IsDelete {
+			err = json.Unmarshal(response.Value, &fields)
+			if err != nil {
+				return shim.Error("Failed to decode historic value of " + workId + " in tx " + response.TxId)
+			}
+		}
+		modifications = append(modifications, modification{
+			txId:     response.TxId,
+			modified: time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC(),
+			isDelete: response.IsDelete,
+			fields:   fields,
+		})
+	}
+	// the history comes in commit order, each version is diffed against the one committed before it
+	diffs := []workHistoryDiff{}
+	previous := map[string]json.RawMessage{}
+	for _, m := range modifications {
+		changes := workrecord.DiffFields(previous, m.fields)
+		previous = m.fields
+
+		// the window only limits what is reported, diffs are always against the value before
+		if (!from.IsZero() && m.modified.Before(from)) || (!to.IsZero() && m.modified.After(to)) {
+			continue
+		}
+		if len(wantFields) > 0 {
+			filtered := []fieldChange{}
+			for _, change := range changes {
+				if wantFields[change.Field] {
+					filtered = append(filtered, change)
+				}
+			}
+			changes = filtered
+		}
+		if len(changes) == 0 && !m.isDelete {
+			continue
+		}
+		diffs = append(diffs, workHistoryDiff{
+			TxId:      m.txId,
+			Timestamp: m.modified.Format(time.RFC3339Nano),
+			IsDelete:  m.isDelete,
+			Changes:   changes,
+		})
+	}
+
+	diffsAsBytes, err := json.Marshal(diffs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Printf("- end getHistoryDiffsForWork: %d versions\n", len(diffs))
+
+	return shim.Success(diffsAsBytes)
+}
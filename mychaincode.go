@@ -3,19 +3,21 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"time"
-	"bytes"
-	"crypto/x509"
-	"encoding/pem"
+	"encoding/hex"
+	"mime"
+	"net/url"
+	"strconv"
 	"strings"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"  
+	"github.com/tangsk/newchaincode/identity"
+	"github.com/tangsk/newchaincode/workdate"
 )
 
 // 合同全集详情
 // 本条记录主键key由成员ID和合同ID联合组成，具备唯一性
 type Work struct {
-	Timestamp        int64  `json:"timestamp"`        // 本条记录创建时间戳
+	Timestamp        int64  `json:"timestamp"`        // 本条记录创建时间戳（交易时间）
 	Uid              string `json:"uid"`              // 用户唯一ID（32位MD5值）
 	Workexperience   string `json:"workexperience"`   // 用户工作经历
 	ApplyDate        string `json:"applyDate"`        // 申请日期
@@ -23,32 +25,81 @@ type Work struct {
 	WorkEndDate      string `json:"workEndDate"`      // 工作终止日期
 }
 
+// 简历文件锚定记录，文件本身保存在链下，链上只保存其摘要
+// 本条记录主键key由简历ID和文件SHA-256摘要联合组成，同一简历可锚定多个文件
+type ResumeDocument struct {
+	ResumeId  string   `json:"resumeId"`  // 简历ID
+	Hash      string   `json:"hash"`      // 文件内容SHA-256摘要（64位十六进制）
+	Size      int64    `json:"size"`      // 文件大小（字节）
+	MimeType  string   `json:"mimeType"`  // 文件类型，如application/pdf
+	Uri       string   `json:"uri"`       // 文件存储地址
+	Owner     string   `json:"owner"`     // 锚定文件的成员名称
+	Works     []string `json:"works"`     // 文件所支持的工作经历，以简历ID标识，对应Owner名下主键为(Owner, 简历ID)的Work记录
+	Timestamp int64    `json:"timestamp"` // 锚定时间戳（交易时间）
+}
+
+// 链码事件类型，事件名即事件类型，负载为Event
+const (
+	EventWorkCreated            = "WorkCreated"            // 记录工作经历
+	EventResumeDocumentAnchored = "ResumeDocumentAnchored" // 锚定简历文件
+	EventResumeDocumentLinked   = "ResumeDocumentLinked"   // 简历文件关联工作经历
+)
+
+// 链码事件负载
+type Event struct {
+	Type          string   `json:"type"`           // 事件类型
+	Uid           string   `json:"uid,omitempty"`  // 用户唯一ID，仅工作经历事件
+	ResumeId      string   `json:"resumeId"`       // 简历ID
+	Hash          string   `json:"hash,omitempty"` // 文件SHA-256摘要，仅简历文件事件
+	Actor         string   `json:"actor"`          // 操作成员名称
+	TxId          string   `json:"txId"`           // 交易ID
+	ChangedFields []string `json:"changedFields"`  // 变更的字段
+}
+
 // 贷款操作
 // args：UID、工作经历、申请日期、工作开始日期、工作终止日期、简历ID
 // name：成员名称
-func Work(stub shim.ChaincodeStubInterface, args []string, name string) error {
+func SaveWork(stub shim.ChaincodeStubInterface, args []string, name string) error {
 	if len(args) != 6 {
 		return fmt.Errorf("Parameter count error while Work, count must 5")
 	}
 	if len(args[0]) != 32 {
 		return fmt.Errorf("Parameter uid length error while Work, 32 is right")
 	}
-	if len(args[2]) != 14 {
-		return fmt.Errorf("Parameter ApplyDate length error while Work, 14 is right")
+	config, err := GetIdentityConfig(stub)
+	if err != nil {
+		return err
+	}
+	location, err := workdate.Location(config.Timezone)
+	if err != nil {
+		return err
+	}
+	applyDate, err := workdate.Parse(args[2], config.DateFormat, location)
+	if err != nil {
+		return fmt.Errorf("Parameter ApplyDate error while Work: %s", err)
+	}
+	workStartDate, err := workdate.Parse(args[3], config.DateFormat, location)
+	if err != nil {
+		return fmt.Errorf("Parameter WorkStartDate error while Work: %s", err)
 	}
-	if len(args[3]) != 14 {
-		return fmt.Errorf("Parameter WorkStartDate length error while Work, 14 is right")
+	workEndDate, err := workdate.Parse(args[4], config.DateFormat, location)
+	if err != nil {
+		return fmt.Errorf("Parameter WorkEndDate error while Work: %s", err)
 	}
-	if len(args[4]) != 14 {
-		return fmt.Errorf("Parameter WorkEndDate length error while Work, 14 is right")
+	if !workEndDate.After(workStartDate) {
+		return fmt.Errorf("Parameter WorkEndDate error while Work, must be after WorkStartDate")
 	}
 	var work Work
 	work.Uid = args[0]
 	work.Workexperience = args[1]
-	work.ApplyDate = args[2]
-	work.WorkStartDate = args[3]
-	work.WorkEndDate = args[4]
-	work.Timestamp = time.Now().Unix()
+	work.ApplyDate = workdate.Format(applyDate)
+	work.WorkStartDate = workdate.Format(workStartDate)
+	work.WorkEndDate = workdate.Format(workEndDate)
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("Failed to GetTxTimestamp while Work: %s", err)
+	}
+	work.Timestamp = txTimestamp.Seconds // 使用交易时间，各背书节点结果一致
 
 	workJsonBytes, err := json.Marshal(&work) // Json序列化
 	if err != nil {
@@ -64,51 +115,386 @@ func Work(stub shim.ChaincodeStubInterface, args []string, name string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to PutState while Work, work id = " + args[5])
 	}
+	return SetEvent(stub, Event{Type: EventWorkCreated, Uid: work.Uid, ResumeId: args[5], Actor: name,
+		ChangedFields: []string{"uid", "workexperience", "applyDate", "workStartDate", "workEndDate"}})
+}
+
+// 锚定简历文件
+// args：简历ID、文件SHA-256摘要、文件大小、文件类型、存储地址，以及可选的工作经历简历ID（SaveWork的第6个参数）
+// name：成员名称
+func SaveResumeDocument(stub shim.ChaincodeStubInterface, args []string, name string) error {
+	if len(args) < 5 {
+		return fmt.Errorf("Parameter count error while ResumeDocument, count must be at least 5")
+	}
+	if len(args[0]) == 0 {
+		return fmt.Errorf("Parameter resumeId error while ResumeDocument, must not be empty")
+	}
+	hash, err := ParseDocumentHash(args[1])
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("Parameter size error while ResumeDocument, must be a positive number")
+	}
+	mimeType, _, err := mime.ParseMediaType(args[3])
+	if err != nil {
+		return fmt.Errorf("Parameter mimeType error while ResumeDocument: %s", err)
+	}
+	uri, err := url.Parse(args[4])
+	if err != nil || uri.Scheme == "" {
+		return fmt.Errorf("Parameter uri error while ResumeDocument, must be an absolute URI")
+	}
+
+	key, err := stub.CreateCompositeKey("ResumeDocument", []string{args[0], hash})
+	if err != nil {
+		return fmt.Errorf("Failed to CreateCompositeKey while ResumeDocument")
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return fmt.Errorf("Failed to GetState while ResumeDocument: %s", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("Document %s is already anchored under resume %s", hash, args[0])
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("Failed to GetTxTimestamp while ResumeDocument: %s", err)
+	}
+
+	document := ResumeDocument{
+		ResumeId:  args[0],
+		Hash:      hash,
+		Size:      size,
+		MimeType:  mimeType,
+		Uri:       uri.String(),
+		Owner:     name,
+		Works:     []string{},
+		Timestamp: txTimestamp.Seconds,
+	}
+	for _, workResumeId := range args[5:] {
+		err = LinkWork(stub, &document, workResumeId)
+		if err != nil {
+			return err
+		}
+	}
+	err = PutResumeDocument(stub, key, &document)
+	if err != nil {
+		return err
+	}
+	return SetEvent(stub, Event{Type: EventResumeDocumentAnchored, ResumeId: document.ResumeId, Hash: hash, Actor: name,
+		ChangedFields: []string{"size", "mimeType", "uri", "owner", "works"}})
+}
+
+// 将已锚定的简历文件关联到成员名下的工作经历
+// args：简历ID、文件SHA-256摘要、工作经历简历ID（SaveWork的第6个参数）
+// name：成员名称
+func LinkResumeDocument(stub shim.ChaincodeStubInterface, args []string, name string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("Parameter count error while LinkResumeDocument, count must 3")
+	}
+	document, key, err := GetResumeDocument(stub, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if document == nil {
+		return fmt.Errorf("Document %s is not anchored under resume %s", args[1], args[0])
+	}
+	if document.Owner != name {
+		return fmt.Errorf("Only %s may link document %s", document.Owner, document.Hash)
+	}
+	err = LinkWork(stub, document, args[2])
+	if err != nil {
+		return err
+	}
+	err = PutResumeDocument(stub, key, document)
+	if err != nil {
+		return err
+	}
+	return SetEvent(stub, Event{Type: EventResumeDocumentLinked, ResumeId: document.ResumeId, Hash: document.Hash, Actor: name,
+		ChangedFields: []string{"works"}})
+}
+
+// 记录文件所支持的工作经历，工作经历须已由文件所有者记录
+// Work记录的主键由成员名称和简历ID组成，没有单独的工作经历ID，因此以记录工作经历时的简历ID标识工作经历
+func LinkWork(stub shim.ChaincodeStubInterface, document *ResumeDocument, workResumeId string) error {
+	for _, linked := range document.Works {
+		if linked == workResumeId {
+			return nil
+		}
+	}
+	workKey, err := stub.CreateCompositeKey("Work", []string{document.Owner, workResumeId})
+	if err != nil {
+		return fmt.Errorf("Failed to CreateCompositeKey while LinkWork")
+	}
+	workJsonBytes, err := stub.GetState(workKey)
+	if err != nil {
+		return fmt.Errorf("Failed to GetState while LinkWork: %s", err)
+	}
+	if workJsonBytes == nil {
+		return fmt.Errorf("Work of %s under resume %s does not exist", document.Owner, workResumeId)
+	}
+	document.Works = append(document.Works, workResumeId)
 	return nil
 }
 
+// 读取简历文件锚定记录，未锚定时返回nil
+func GetResumeDocument(stub shim.ChaincodeStubInterface, resumeId string, hash string) (*ResumeDocument, string, error) {
+	hash, err := ParseDocumentHash(hash)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := stub.CreateCompositeKey("ResumeDocument", []string{resumeId, hash})
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to CreateCompositeKey while GetResumeDocument")
+	}
+	documentJsonBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to GetState while GetResumeDocument: %s", err)
+	}
+	if documentJsonBytes == nil {
+		return nil, key, nil
+	}
+	var document ResumeDocument
+	err = json.Unmarshal(documentJsonBytes, &document)
+	if err != nil {
+		return nil, "", fmt.Errorf("Json deserialize ResumeDocument fail while GetResumeDocument: %s", err)
+	}
+	return &document, key, nil
+}
 
+// 保存简历文件锚定记录
+func PutResumeDocument(stub shim.ChaincodeStubInterface, key string, document *ResumeDocument) error {
+	documentJsonBytes, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("Json serialize ResumeDocument fail, resume id = " + document.ResumeId)
+	}
+	err = stub.PutState(key, documentJsonBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to PutState while ResumeDocument, resume id = " + document.ResumeId)
+	}
+	return nil
+}
 
-// 获取当前操作智能合约成员的具体名称，如a1aw28
-func GetCreatorName(stub shim.ChaincodeStubInterface) (string, error) {
-	name, err := GetCreator(stub) // 获取当前智能合约操作成员名称
+// 发送链码事件，填入交易ID
+func SetEvent(stub shim.ChaincodeStubInterface, event Event) error {
+	event.TxId = stub.GetTxID()
+	eventJsonBytes, err := json.Marshal(&event)
+	if err != nil {
+		return fmt.Errorf("Json serialize Event fail, event type = " + event.Type)
+	}
+	err = stub.SetEvent(event.Type, eventJsonBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to SetEvent %s: %s", event.Type, err)
+	}
+	return nil
+}
+
+// 校验文件摘要为SHA-256十六进制字符串，统一转为小写
+func ParseDocumentHash(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("Parameter hash error, must be a hex SHA-256 digest")
+	}
+	return hash, nil
+}
+
+// 组织角色
+const (
+	RoleEmployer  = "employer"  // 雇主
+	RoleCandidate = "candidate" // 求职者
+	RoleRecruiter = "recruiter" // 招聘方
+	RoleAdmin     = "admin"     // 管理员
+)
+
+// 成员组织MSP ID与角色的对应关系，未登记的组织无权写入账本
+var OrgRoles = map[string][]string{
+	"Org1MSP": {RoleCandidate, RoleAdmin},
+	"Org2MSP": {RoleEmployer},
+	"Org3MSP": {RoleEmployer},
+	"Org4MSP": {RoleRecruiter},
+}
+
+// Init或updateConfig保存的配置，保存在联合主键Config~identity下，各版本另存于ConfigHistory~版本号下
+type IdentityConfig struct {
+	identity.Config        // 身份解析策略，见identity包
+	DateFormat      string `json:"dateFormat,omitempty"` // 输入日期的Go时间格式，默认yyyyMMddHHmmss，始终兼容yyyyMMddHHmmss及ISO-8601
+	Timezone        string `json:"timezone,omitempty"`   // 未带时区的日期所用时区，UTC或+08:00形式的固定偏移，默认UTC
+	Version         int    `json:"version"`              // 配置版本，每次保存加1
+	TxId            string `json:"txId"`                 // 保存配置的交易ID
+	UpdatedBy       string `json:"updatedBy"`            // 保存配置的成员名称
+}
+
+// 校验当前操作成员所属组织具备所需角色之一，返回成员名称
+func AuthorizeCreator(stub shim.ChaincodeStubInterface, roles ...string) (string, error) {
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return "", err
+	}
+	for _, role := range OrgRoles[caller.MSPID] {
+		for _, want := range roles {
+			if role == want {
+				return ResolveCreatorName(stub, caller)
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not authorized, expecting one of the roles %s", caller.MSPID, strings.Join(roles, ", "))
+}
+
+// 按Init配置的策略解析成员名称，解析失败时返回错误
+func ResolveCreatorName(stub shim.ChaincodeStubInterface, caller *identity.Caller) (string, error) {
+	config, err := GetIdentityConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	resolver, err := identity.NewResolver(config.Config)
 	if err != nil {
 		return "", err
 	}
-	// 格式化当前智能合约操作成员名称
-	memberName := name[(strings.Index(name, "@") + 1):strings.LastIndex(name, ".example.com")]
-	return memberName, nil
+	name, err := resolver.Resolve(caller)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve creator name: %s", err)
+	}
+	return name, nil
 }
 
-// 获取操作成员
-func GetCreator(stub shim.ChaincodeStubInterface) (string, error) {
-	creatorByte, _ := stub.GetCreator()
-	certStart := bytes.IndexAny(creatorByte, "-----BEGIN")
-	if certStart == -1 {
-		fmt.Errorf("No certificate found")
+// 读取Init保存的身份解析配置，未配置时使用MSP ID加注册ID
+func GetIdentityConfig(stub shim.ChaincodeStubInterface) (*IdentityConfig, error) {
+	key, err := stub.CreateCompositeKey("Config", []string{"identity"})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to CreateCompositeKey while GetIdentityConfig")
+	}
+	configJsonBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to GetState while GetIdentityConfig: %s", err)
+	}
+	config := &IdentityConfig{Config: identity.Config{Strategy: identity.StrategyMSPEnrollment}}
+	if configJsonBytes == nil {
+		return config, nil
+	}
+	err = json.Unmarshal(configJsonBytes, config)
+	if err != nil {
+		return nil, fmt.Errorf("Json deserialize IdentityConfig fail: %s", err)
+	}
+	return config, nil
+}
+
+// 是否已保存配置
+func HasIdentityConfig(stub shim.ChaincodeStubInterface) (bool, error) {
+	key, err := stub.CreateCompositeKey("Config", []string{"identity"})
+	if err != nil {
+		return false, fmt.Errorf("Failed to CreateCompositeKey while HasIdentityConfig")
+	}
+	configJsonBytes, err := stub.GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("Failed to GetState while HasIdentityConfig: %s", err)
+	}
+	return configJsonBytes != nil, nil
+}
+
+// 解析并校验配置JSON，拒绝未知字段，未指定身份解析策略时使用MSP ID加注册ID
+func ParseIdentityConfig(configJson string) (*IdentityConfig, error) {
+	config := &IdentityConfig{Config: identity.Config{Strategy: identity.StrategyMSPEnrollment}}
+	decoder := json.NewDecoder(strings.NewReader(configJson))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("Json deserialize IdentityConfig fail: %s", err)
+	}
+	_, err = identity.NewResolver(config.Config)
+	if err != nil {
+		return nil, err
+	}
+	if config.DateFormat != "" {
+		err = workdate.CheckLayout(config.DateFormat)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter dateFormat error: %s", err)
+		}
+	}
+	_, err = workdate.Location(config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// 保存配置为下一版本，并在ConfigHistory~版本号下保留副本
+// 保存者名称按新配置的策略解析
+func PutIdentityConfig(stub shim.ChaincodeStubInterface, config *IdentityConfig) error {
+	current, err := GetIdentityConfig(stub)
+	if err != nil {
+		return err
+	}
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return err
+	}
+	resolver, err := identity.NewResolver(config.Config)
+	if err != nil {
+		return err
 	}
-	certText := creatorByte[certStart:]
-	bl, _ := pem.Decode(certText)
-	if bl == nil {
-		fmt.Errorf("Could not decode the PEM structure")
+	config.UpdatedBy, err = resolver.Resolve(caller)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve creator name: %s", err)
 	}
+	config.Version = current.Version + 1
+	config.TxId = stub.GetTxID()
 
-	cert, err := x509.ParseCertificate(bl.Bytes)
+	configJsonBytes, err := json.Marshal(config)
 	if err != nil {
-		fmt.Errorf("ParseCertificate failed")
+		return fmt.Errorf("Json serialize IdentityConfig fail")
 	}
-	uname := cert.Subject.CommonName
-	return uname, nil
+	key, err := stub.CreateCompositeKey("Config", []string{"identity"})
+	if err != nil {
+		return fmt.Errorf("Failed to CreateCompositeKey while PutIdentityConfig")
+	}
+	err = stub.PutState(key, configJsonBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to PutState while PutIdentityConfig")
+	}
+	historyKey, err := stub.CreateCompositeKey("ConfigHistory", []string{fmt.Sprintf("%010d", config.Version)})
+	if err != nil {
+		return fmt.Errorf("Failed to CreateCompositeKey while PutIdentityConfig")
+	}
+	err = stub.PutState(historyKey, configJsonBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to PutState while PutIdentityConfig, version = %d", config.Version)
+	}
+	return nil
 }
 
 type Experience struct {
 }
 
+// 初始化，可选参数为配置JSON，如{"identityStrategy":"cnRegex","identityPattern":"@([^.]+)\\.","dateFormat":"2006-01-02","timezone":"+08:00"}
+// 升级时不带参数则保留已保存的配置；已有配置时仅管理员可通过Init修改，同updateConfig
 func (t *Experience) Init(stub shim.ChaincodeStubInterface) peer.Response {
-	args := stub.GetStringArgs()
-	if len(args) != 0 {
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+	if len(args) != 1 {
 		return shim.Error("Parameter error while Init")
 	}
+	configured, err := HasIdentityConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if configured {
+		_, err = AuthorizeCreator(stub, RoleAdmin)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	config, err := ParseIdentityConfig(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = PutIdentityConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -117,6 +503,16 @@ func (t *Experience) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 	switch fn {
 	case "work": // 记录工作
 		return work(stub, args)
+	case "anchorResumeDocument": // 锚定简历文件
+		return anchorResumeDocument(stub, args)
+	case "linkResumeDocument": // 关联简历文件与工作经历
+		return linkResumeDocument(stub, args)
+	case "verifyResumeDocument": // 校验简历文件
+		return verifyResumeDocument(stub, args)
+	case "updateConfig": // 更新配置
+		return updateConfig(stub, args)
+	case "getConfigHistory": // 查询配置的各个版本
+		return getConfigHistory(stub, args)
 	default:
 		return shim.Error("Unknown func type while Invoke, please check")
 	}
@@ -124,12 +520,12 @@ func (t *Experience) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 
 // 记录贷款数据
 func work(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	name, err := utils.GetCreatorName(stub)
+	name, err := AuthorizeCreator(stub, RoleCandidate)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	err = bean.Work(stub, args, name)
+	err = SaveWork(stub, args, name)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -137,8 +533,108 @@ func work(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	return shim.Success([]byte("记录工作经历成功"))
 }
 
+// 锚定简历文件
+func anchorResumeDocument(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	name, err := AuthorizeCreator(stub, RoleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = SaveResumeDocument(stub, args, name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte("锚定简历文件成功"))
+}
+
+// 关联简历文件与工作经历
+func linkResumeDocument(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	name, err := AuthorizeCreator(stub, RoleCandidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = LinkResumeDocument(stub, args, name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte("关联简历文件成功"))
+}
+
+// 校验简历文件，args：简历ID、文件SHA-256摘要
+// 文件已锚定在该简历下时返回锚定记录，否则返回错误
+func verifyResumeDocument(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("Parameter count error while verifyResumeDocument, count must 2")
+	}
+	document, _, err := GetResumeDocument(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if document == nil {
+		return shim.Error("Document " + args[1] + " is not anchored under resume " + args[0] + ", it is not authentic")
+	}
+	documentJsonBytes, err := json.Marshal(document)
+	if err != nil {
+		return shim.Error("Json serialize ResumeDocument fail while verifyResumeDocument")
+	}
+	return shim.Success(documentJsonBytes)
+}
+
+// 更新配置，args：配置JSON，校验同Init，仅管理员可操作
+// 旧版本保留，可通过getConfigHistory查询
+func updateConfig(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("Parameter count error while updateConfig, count must 1")
+	}
+	_, err := AuthorizeCreator(stub, RoleAdmin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := ParseIdentityConfig(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = PutIdentityConfig(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	configJsonBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error("Json serialize IdentityConfig fail while updateConfig")
+	}
+	return shim.Success(configJsonBytes)
+}
+
+// 查询配置的各个版本，按版本号从旧到新排列
+func getConfigHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 0 {
+		return shim.Error("Parameter count error while getConfigHistory, count must 0")
+	}
+	iterator, err := stub.GetStateByPartialCompositeKey("ConfigHistory", []string{})
+	if err != nil {
+		return shim.Error("Failed to GetStateByPartialCompositeKey while getConfigHistory: " + err.Error())
+	}
+	defer iterator.Close()
+	versions := []json.RawMessage{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return shim.Error("Failed to iterate while getConfigHistory: " + err.Error())
+		}
+		versions = append(versions, response.Value)
+	}
+	versionsJsonBytes, err := json.Marshal(versions)
+	if err != nil {
+		return shim.Error("Json serialize config history fail while getConfigHistory")
+	}
+	return shim.Success(versionsJsonBytes)
+}
+
 func main() {
-	if err := shim.Start(new(Finance)); err != nil {
+	if err := shim.Start(new(Experience)); err != nil {
 		fmt.Printf("Chaincode startup error: %s", err)
 	}
 }
@@ -0,0 +1,56 @@
+// Package txevent emits the chaincode events of the chaincodes of this repository.
+//
+// Every event payload records who submitted the transaction and its ID. The
+// submitter is named with the identity strategy of the contract configuration,
+// so events name callers the way the records written by the transaction do.
+package txevent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/tangsk/newchaincode/identity"
+)
+
+// Payload is an event payload that records the submitter and the transaction
+type Payload interface {
+	SetOrigin(actor string, txId string)
+}
+
+// Emit names the submitter of the transaction with the resolver chosen by config,
+// records it and the transaction ID on payload and sets payload as the event name.
+// The event must not fail the transaction it reports on, so a submitter that can
+// not be resolved is named by its MSP ID, see Actor.
+func Emit(stub shim.ChaincodeStubInterface, config identity.Config, name string, payload Payload) error {
+	payload.SetOrigin(Actor(stub, config), stub.GetTxID())
+
+	payloadAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s event: %s", name, err)
+	}
+	err = stub.SetEvent(name, payloadAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to set %s event: %s", name, err)
+	}
+	return nil
+}
+
+// Actor names the submitter of the transaction with the resolver chosen by config.
+// When the name can not be resolved it falls back to the MSP ID of the submitter,
+// and to an empty name when the submitter can not be read at all.
+func Actor(stub shim.ChaincodeStubInterface, config identity.Config) string {
+	caller, err := identity.GetCaller(stub)
+	if err != nil {
+		return ""
+	}
+	resolver, err := identity.NewResolver(config)
+	if err != nil {
+		return caller.MSPID
+	}
+	name, err := resolver.Resolve(caller)
+	if err != nil {
+		return caller.MSPID
+	}
+	return name
+}
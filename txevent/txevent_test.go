@@ -0,0 +1,82 @@
+package txevent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/tangsk/newchaincode/identity"
+)
+
+type testEvent struct {
+	Type  string `json:"type"`
+	Actor string `json:"actor"`
+	TxId  string `json:"txId"`
+}
+
+func (e *testEvent) SetOrigin(actor string, txId string) {
+	e.Actor = actor
+	e.TxId = txId
+}
+
+// newStub returns a mock stub whose transactions are submitted by Org2MSP with the given CN
+func newStub(t *testing.T, commonName string) *shim.MockStub {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org2MSP",
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	stub := shim.NewMockStub("txevent", nil)
+	stub.Creator = creator
+	return stub
+}
+
+func TestEmit(t *testing.T) {
+	stub := newStub(t, "alice@org2.example.com")
+	err := Emit(stub, identity.Config{Strategy: identity.StrategyCNRegex, Pattern: "^([^@]+)@"}, "WorkCreated", &testEvent{Type: "WorkCreated"})
+	if err != nil {
+		t.Fatalf("Emit: %s", err)
+	}
+	event := <-stub.ChaincodeEventsChannel
+	var payload testEvent
+	if err = json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if event.EventName != "WorkCreated" || payload.Actor != "alice" || payload.TxId != stub.GetTxID() {
+		t.Errorf("Emit set %s %+v, want WorkCreated by alice", event.EventName, payload)
+	}
+}
+
+func TestActorFallsBackToMSPID(t *testing.T) {
+	stub := newStub(t, "bob")
+	if actor := Actor(stub, identity.Config{Strategy: identity.StrategyCNRegex, Pattern: "^([^@]+)@"}); actor != "Org2MSP" {
+		t.Errorf("Actor of an unresolvable CN = %q, want Org2MSP", actor)
+	}
+	if actor := Actor(shim.NewMockStub("txevent", nil), identity.Config{}); actor != "" {
+		t.Errorf("Actor without a creator = %q, want an empty name", actor)
+	}
+}
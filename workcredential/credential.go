@@ -0,0 +1,134 @@
+// Package workcredential builds and verifies W3C Verifiable Credentials for attested works.
+//
+// The chaincode issues a credential with exportWorkCredential. The proof of the credential
+// does not carry a signature: chaincode holds no private keys and must produce the same
+// output on every endorsing peer. It anchors the credential to the ledger instead, with the
+// hash of the work record in state, the attesting transaction and a hash of the credential.
+// A verifier holding a ledger snapshot of the work, or a hash recorded earlier, checks the
+// credential offline with the Verify functions of this package.
+package workcredential
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Values of the credential document
+const (
+	ContextCredentialsV1     = "https://www.w3.org/2018/credentials/v1"
+	TypeVerifiableCredential = "VerifiableCredential"
+	TypeEmploymentCredential = "EmploymentCredential"
+	ProofTypeLedgerAnchor    = "FabricLedgerAnchor"
+	ProofPurposeAssertion    = "assertionMethod"
+)
+
+// Credential is a W3C Verifiable Credential stating one attested work
+type Credential struct {
+	Context           []string `json:"@context"`
+	Id                string   `json:"id"`
+	Type              []string `json:"type"`
+	Issuer            string   `json:"issuer"`       //DID of the employer org
+	IssuanceDate      string   `json:"issuanceDate"` //RFC3339
+	CredentialSubject Subject  `json:"credentialSubject"`
+	Proof             *Proof   `json:"proof,omitempty"`
+}
+
+// Subject holds the fields of the work the credential states
+type Subject struct {
+	Id             string `json:"id"` //the uid as a URN
+	WorkId         string `json:"workId"`
+	Workstartdate  string `json:"workstartdate"` //yyyyMMddHHmmss UTC
+	Workenddate    int    `json:"workenddate"`   //yyyyMMddHHmmss UTC
+	Workexperience string `json:"workexperience"`
+	Employer       string `json:"employer"` //MSP ID of the attesting org
+}
+
+// Proof anchors a credential to the ledger
+type Proof struct {
+	Type               string `json:"type"`
+	Created            string `json:"created"` //RFC3339, when the work was attested
+	ProofPurpose       string `json:"proofPurpose"`
+	VerificationMethod string `json:"verificationMethod"`
+	Channel            string `json:"channel"`
+	TxId               string `json:"txId"`           //transaction that attested the work
+	Reviewer           string `json:"reviewer"`       //resolved name of the attesting identity
+	RecordHash         string `json:"recordHash"`     //sha256 of the work record in state at issuance
+	CredentialHash     string `json:"credentialHash"` //sha256 of the canonical credential without its proof
+}
+
+// IssuerDID returns the DID of an org of a channel, e.g. did:fabric:mychannel:Org2MSP
+func IssuerDID(channel string, mspId string) string {
+	return "did:fabric:" + channel + ":" + mspId
+}
+
+// SubjectId returns the credential subject id of a uid
+func SubjectId(uid string) string {
+	return "urn:uid:" + uid
+}
+
+// CredentialId returns the id of the credential of a work
+func CredentialId(channel string, workId string) string {
+	return "urn:work:" + channel + ":" + workId
+}
+
+// RecordHash returns the hex sha256 of a work record as stored in state
+func RecordHash(record []byte) string {
+	sum := sha256.Sum256(record)
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash returns the hex sha256 of the canonical JSON of the credential without its proof.
+// Canonical JSON has its object keys sorted and no insignificant whitespace.
+func Hash(c *Credential) (string, error) {
+	unsealed := *c
+	unsealed.Proof = nil
+	canonical, err := canonicalJSON(&unsealed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Seal sets the proof of the credential, filling in its credential hash
+func Seal(c *Credential, proof Proof) error {
+	hash, err := Hash(c)
+	if err != nil {
+		return err
+	}
+	proof.CredentialHash = hash
+	c.Proof = &proof
+	return nil
+}
+
+// Parse decodes a credential document
+func Parse(document []byte) (*Credential, error) {
+	c := &Credential{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode credential: %s", err)
+	}
+	return c, nil
+}
+
+// canonicalJSON marshals v with sorted object keys, decoding it into
+// generic maps first since encoding/json sorts map keys
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	err = decoder.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
@@ -0,0 +1,96 @@
+package workcredential
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Status a work record must have for its credential to hold
+const statusVerified = "verified"
+
+// VerifyIntegrity checks the structure of the credential and that
+// it was not changed since it was sealed
+func VerifyIntegrity(c *Credential) error {
+	if !contains(c.Context, ContextCredentialsV1) {
+		return fmt.Errorf("@context must include %s", ContextCredentialsV1)
+	}
+	if !contains(c.Type, TypeVerifiableCredential) || !contains(c.Type, TypeEmploymentCredential) {
+		return fmt.Errorf("type must include %s and %s", TypeVerifiableCredential, TypeEmploymentCredential)
+	}
+	if c.Proof == nil {
+		return fmt.Errorf("Credential has no proof")
+	}
+	if c.Proof.Type != ProofTypeLedgerAnchor {
+		return fmt.Errorf("Unsupported proof type %s", c.Proof.Type)
+	}
+	if c.Issuer != IssuerDID(c.Proof.Channel, c.CredentialSubject.Employer) {
+		return fmt.Errorf("Issuer %s is not the employer %s", c.Issuer, c.CredentialSubject.Employer)
+	}
+	hash, err := Hash(c)
+	if err != nil {
+		return err
+	}
+	if hash != c.Proof.CredentialHash {
+		return fmt.Errorf("Credential hash mismatch, the credential was changed after it was issued")
+	}
+	return nil
+}
+
+// VerifyAgainstRecord checks the credential against the work record taken from a ledger
+// snapshot, e.g. the value readWork returns. The record must be the one the credential was
+// issued from and still be verified, so a work changed or revoked since does not verify.
+func VerifyAgainstRecord(c *Credential, record []byte) error {
+	err := VerifyIntegrity(c)
+	if err != nil {
+		return err
+	}
+	if RecordHash(record) != c.Proof.RecordHash {
+		return fmt.Errorf("Work record hash mismatch, the work changed since the credential was issued")
+	}
+
+	var fields struct {
+		WorkId         string `json:"workId"`
+		CandidateUid   string `json:"candidateUid"`
+		Workstartdate  string `json:"workstartdate"`
+		Workenddate    int    `json:"workenddate"`
+		Workexperience string `json:"workexperience"`
+		Employer       string `json:"employer"`
+		Status         string `json:"status"`
+	}
+	err = json.Unmarshal(record, &fields)
+	if err != nil {
+		return fmt.Errorf("Failed to decode work record: %s", err)
+	}
+	subject := c.CredentialSubject
+	if fields.Status != statusVerified {
+		return fmt.Errorf("Work %s is %s", fields.WorkId, fields.Status)
+	}
+	if SubjectId(fields.CandidateUid) != subject.Id || fields.WorkId != subject.WorkId ||
+		fields.Workstartdate != subject.Workstartdate || fields.Workenddate != subject.Workenddate ||
+		fields.Workexperience != subject.Workexperience || fields.Employer != subject.Employer {
+		return fmt.Errorf("Credential subject does not match work %s", fields.WorkId)
+	}
+	return nil
+}
+
+// VerifyAgainstHash checks the credential against a credential hash
+// recorded when it was issued or published by the employer
+func VerifyAgainstHash(c *Credential, recordedHash string) error {
+	err := VerifyIntegrity(c)
+	if err != nil {
+		return err
+	}
+	if c.Proof.CredentialHash != recordedHash {
+		return fmt.Errorf("Credential hash %s does not match the recorded hash", c.Proof.CredentialHash)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package workcredential
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRecord = `{"docType":"work","schemaVersion":1,"workId":"work1","workstartdate":"20150301010000",` +
+	`"workenddate":20180630100000,"workexperience":"engineer","candidateUid":"c4ca4238","employer":"Org2MSP","status":"verified"}`
+
+// newSealedCredential returns the credential of the work in testRecord as exportWorkCredential issues it
+func newSealedCredential(t *testing.T) *Credential {
+	c := &Credential{
+		Context:      []string{ContextCredentialsV1},
+		Id:           CredentialId("mychannel", "work1"),
+		Type:         []string{TypeVerifiableCredential, TypeEmploymentCredential},
+		Issuer:       IssuerDID("mychannel", "Org2MSP"),
+		IssuanceDate: "2019-01-01T00:00:00Z",
+		CredentialSubject: Subject{
+			Id:             SubjectId("c4ca4238"),
+			WorkId:         "work1",
+			Workstartdate:  "20150301010000",
+			Workenddate:    20180630100000,
+			Workexperience: "engineer",
+			Employer:       "Org2MSP",
+		},
+	}
+	err := Seal(c, Proof{
+		Type:               ProofTypeLedgerAnchor,
+		Created:            "2018-07-01T00:00:00Z",
+		ProofPurpose:       ProofPurposeAssertion,
+		VerificationMethod: IssuerDID("mychannel", "Org2MSP"),
+		Channel:            "mychannel",
+		TxId:               "tx1",
+		Reviewer:           "Org2MSP:bob",
+		RecordHash:         RecordHash([]byte(testRecord)),
+	})
+	if err != nil {
+		t.Fatalf("Seal: %s", err)
+	}
+	return c
+}
+
+func TestVerifyAgainstRecord(t *testing.T) {
+	c := newSealedCredential(t)
+	if err := VerifyAgainstRecord(c, []byte(testRecord)); err != nil {
+		t.Fatalf("VerifyAgainstRecord of the issuing record: %s", err)
+	}
+
+	revoked := strings.Replace(testRecord, `"status":"verified"`, `"status":"revoked"`, 1)
+	if err := VerifyAgainstRecord(c, []byte(revoked)); err == nil {
+		t.Errorf("VerifyAgainstRecord accepted a changed record")
+	}
+
+	// a record whose hash was anchored but whose fields differ from the subject
+	c = newSealedCredential(t)
+	c.CredentialSubject.Workexperience = "manager"
+	if err := Seal(c, *c.Proof); err != nil {
+		t.Fatalf("Seal: %s", err)
+	}
+	if err := VerifyAgainstRecord(c, []byte(testRecord)); err == nil {
+		t.Errorf("VerifyAgainstRecord accepted a subject not matching the record")
+	}
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	for name, change := range map[string]func(c *Credential){
+		"changed subject":  func(c *Credential) { c.CredentialSubject.Workenddate = 20200630100000 },
+		"other issuer":     func(c *Credential) { c.Issuer = IssuerDID("mychannel", "Org3MSP") },
+		"no proof":         func(c *Credential) { c.Proof = nil },
+		"other proof type": func(c *Credential) { c.Proof.Type = "Ed25519Signature2018" },
+		"missing type":     func(c *Credential) { c.Type = []string{TypeVerifiableCredential} },
+		"missing @context": func(c *Credential) { c.Context = nil },
+		"changed hash":     func(c *Credential) { c.Proof.CredentialHash = strings.Repeat("0", 64) },
+	} {
+		c := newSealedCredential(t)
+		change(c)
+		if err := VerifyIntegrity(c); err == nil {
+			t.Errorf("VerifyIntegrity accepted a credential with %s", name)
+		}
+	}
+}
+
+func TestHashIgnoresProof(t *testing.T) {
+	c := newSealedCredential(t)
+	hash, err := Hash(c)
+	if err != nil {
+		t.Fatalf("Hash: %s", err)
+	}
+	c.Proof.TxId = "tx2"
+	if rehash, _ := Hash(c); rehash != hash || hash != c.Proof.CredentialHash {
+		t.Errorf("Hash depends on the proof: %s, %s, sealed %s", hash, rehash, c.Proof.CredentialHash)
+	}
+}
+
+func TestVerifyAgainstHash(t *testing.T) {
+	c := newSealedCredential(t)
+	if err := VerifyAgainstHash(c, c.Proof.CredentialHash); err != nil {
+		t.Errorf("VerifyAgainstHash of the sealed hash: %s", err)
+	}
+	if err := VerifyAgainstHash(c, strings.Repeat("0", 64)); err == nil {
+		t.Errorf("VerifyAgainstHash accepted another hash")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`{"id":"urn:work:mychannel:work1","signature":"x"}`)); err == nil {
+		t.Errorf("Parse accepted an unknown field")
+	}
+	c, err := Parse([]byte(`{"@context":["` + ContextCredentialsV1 + `"],"id":"urn:work:mychannel:work1"}`))
+	if err != nil || c.Id != "urn:work:mychannel:work1" {
+		t.Errorf("Parse = %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package workdate parses and formats the dates of work records.
+//
+// Work dates are stored in one canonical form, yyyyMMddHHmmss in UTC, whatever
+// layout and timezone they were given in, so that they sort as strings.
+// Dates given without a zone are taken in a configured timezone. Only UTC and
+// fixed offsets like +08:00 are accepted as timezones: zone names such as
+// Asia/Shanghai resolve through the zoneinfo of each peer, whose rules may differ
+// between peers and would make them endorse different values.
+package workdate
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout is the Go layout of stored dates, yyyyMMddHHmmss
+const Layout = "20060102150405"
+
+// ISOLayouts are the ISO-8601 forms accepted besides the configured layout
+var ISOLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// Location returns the timezone of dates given without one.
+// name is empty or UTC for UTC, or a fixed offset like +08:00.
+func Location(name string) (*time.Location, error) {
+	if name == "" || name == "UTC" || name == "Z" {
+		return time.UTC, nil
+	}
+	offset, err := time.Parse("-07:00", name)
+	if err != nil {
+		return nil, fmt.Errorf("Timezone %s must be UTC or a fixed offset like +08:00", name)
+	}
+	_, seconds := offset.Zone()
+	return time.FixedZone(name, seconds), nil
+}
+
+// CheckLayout reports whether layout is a Go date layout, i.e. one that round trips a date
+func CheckLayout(layout string) error {
+	sample := time.Date(2019, time.May, 30, 0, 0, 0, 0, time.UTC)
+	parsed, err := time.Parse(layout, sample.Format(layout))
+	if err != nil || !parsed.Equal(sample) {
+		return fmt.Errorf("%s is not a Go date layout, e.g. %s", layout, Layout)
+	}
+	return nil
+}
+
+// Parse parses a date given in layout, in Layout or in ISO-8601. Layout is always
+// accepted, since end dates are stored as yyyyMMddHHmmss numbers whatever the layout.
+// Dates without a zone are taken in location. Impossible dates such as
+// 20190230000000 are rejected.
+func Parse(value string, layout string, location *time.Location) (time.Time, error) {
+	layouts := []string{Layout}
+	if layout != "" && layout != Layout {
+		layouts = []string{layout, Layout}
+	}
+	for _, l := range append(layouts, ISOLayouts...) {
+		date, err := time.ParseInLocation(l, value, location)
+		if err == nil {
+			return date, nil
+		}
+	}
+	expected := "yyyyMMddHHmmss"
+	if layout != "" && layout != Layout {
+		expected = layout + ", " + expected
+	}
+	return time.Time{}, fmt.Errorf("%s is not a date, expecting %s or ISO-8601", value, expected)
+}
+
+// ParseStored parses a date in the stored form
+func ParseStored(value string) (time.Time, error) {
+	return time.Parse(Layout, value)
+}
+
+// ParseKey parses a date that refers to a stored one, such as a lookup key or a
+// disclosed record. A value in the stored form was read from the ledger and is taken
+// in UTC, whatever location is; other values are parsed as Parse does.
+func ParseKey(value string, layout string, location *time.Location) (time.Time, error) {
+	if len(value) == len(Layout) {
+		if date, err := ParseStored(value); err == nil {
+			return date, nil
+		}
+	}
+	return Parse(value, layout, location)
+}
+
+// Format returns the stored form of a date
+func Format(date time.Time) string {
+	return date.UTC().Format(Layout)
+}
+
+// Normalize returns the stored form of a date given as Parse accepts it
+func Normalize(value string, layout string, location *time.Location) (string, error) {
+	date, err := Parse(value, layout, location)
+	if err != nil {
+		return "", err
+	}
+	return Format(date), nil
+}
+
+// NormalizeKey returns the stored form of a date given as ParseKey accepts it
+func NormalizeKey(value string, layout string, location *time.Location) (string, error) {
+	date, err := ParseKey(value, layout, location)
+	if err != nil {
+		return "", err
+	}
+	return Format(date), nil
+}
@@ -0,0 +1,148 @@
+package workdate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocation(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		offset  int
+		invalid bool
+	}{
+		{"", 0, false},
+		{"UTC", 0, false},
+		{"+08:00", 8 * 3600, false},
+		{"-05:30", -(5*3600 + 30*60), false},
+		{"Asia/Shanghai", 0, true},
+		{"+8", 0, true},
+	} {
+		location, err := Location(tc.name)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("Location(%q) accepted, want an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Location(%q): %s", tc.name, err)
+			continue
+		}
+		_, offset := time.Date(2020, time.January, 1, 0, 0, 0, 0, location).Zone()
+		if offset != tc.offset {
+			t.Errorf("Location(%q) has offset %d, want %d", tc.name, offset, tc.offset)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	shanghai, err := Location("+08:00")
+	if err != nil {
+		t.Fatalf("Location: %s", err)
+	}
+	for _, tc := range []struct {
+		value    string
+		layout   string
+		location *time.Location
+		want     string
+	}{
+		{"20200101083000", "", time.UTC, "20200101083000"},
+		{"20200101083000", "", shanghai, "20200101003000"},
+		{"2020-01-01", "", shanghai, "20191231160000"},
+		{"2020-01-01T08:30:00", "", time.UTC, "20200101083000"},
+		{"2020-01-01T08:30:00+08:00", "", time.UTC, "20200101003000"},
+		{"01/02/2020", "01/02/2006", time.UTC, "20200102000000"},
+		{"2020-01-02", "01/02/2006", time.UTC, "20200102000000"},
+	} {
+		got, err := Normalize(tc.value, tc.layout, tc.location)
+		if err != nil {
+			t.Errorf("Normalize(%q, %q): %s", tc.value, tc.layout, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Normalize(%q, %q) = %s, want %s", tc.value, tc.layout, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeKeyKeepsStoredDates(t *testing.T) {
+	shanghai, err := Location("+08:00")
+	if err != nil {
+		t.Fatalf("Location: %s", err)
+	}
+	for _, tc := range []struct {
+		value  string
+		layout string
+		want   string
+	}{
+		{"20120901090000", "", "20120901090000"},
+		{"20120901090000", "2006-01-02", "20120901090000"},
+		{"2012-09-01T09:00:00", "", "20120901010000"},
+		{"2012-09-01", "2006-01-02", "20120831160000"},
+	} {
+		got, err := NormalizeKey(tc.value, tc.layout, shanghai)
+		if err != nil {
+			t.Errorf("NormalizeKey(%q, %q): %s", tc.value, tc.layout, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("NormalizeKey(%q, %q) = %s, want %s", tc.value, tc.layout, got, tc.want)
+		}
+	}
+	if _, err := ParseKey("20190230000000", "", shanghai); err == nil {
+		t.Errorf("ParseKey accepted 20190230000000")
+	}
+}
+
+func TestParseRejectsInvalidDates(t *testing.T) {
+	for _, value := range []string{"20190230000000", "2019023", "2019-02-30", "yesterday", ""} {
+		if _, err := Parse(value, "", time.UTC); err == nil {
+			t.Errorf("Parse(%q) accepted, want an error", value)
+		}
+	}
+}
+
+func TestParseWithCustomLayout(t *testing.T) {
+	shanghai, err := Location("+08:00")
+	if err != nil {
+		t.Fatalf("Location: %s", err)
+	}
+	// end dates are yyyyMMddHHmmss numbers whatever the layout
+	for value, want := range map[string]string{
+		"2020-01-02":     "20200101160000",
+		"20200630180000": "20200630100000",
+	} {
+		got, err := Normalize(value, "2006-01-02", shanghai)
+		if err != nil || got != want {
+			t.Errorf("Normalize(%q, 2006-01-02) = %s, %v, want %s", value, got, err, want)
+		}
+	}
+	if _, err := Parse("01/02/2020", "2006-01-02", time.UTC); err == nil {
+		t.Errorf("Parse accepted a date in neither layout")
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	for _, layout := range []string{Layout, "2006-01-02", "01/02/2006 15:04"} {
+		if err := CheckLayout(layout); err != nil {
+			t.Errorf("CheckLayout(%q): %s", layout, err)
+		}
+	}
+	for _, layout := range []string{"yyyyMMdd", "2006", "15:04"} {
+		if err := CheckLayout(layout); err == nil {
+			t.Errorf("CheckLayout(%q) accepted, want an error", layout)
+		}
+	}
+}
+
+func TestFormatIsUTC(t *testing.T) {
+	date := time.Date(2020, time.March, 1, 1, 0, 0, 0, time.FixedZone("+02:00", 2*3600))
+	if got := Format(date); got != "20200229230000" {
+		t.Errorf("Format = %s, want 20200229230000", got)
+	}
+	parsed, err := ParseStored("20200229230000")
+	if err != nil || !parsed.Equal(date) {
+		t.Errorf("ParseStored = %v, %v, want %v", parsed, err, date)
+	}
+}
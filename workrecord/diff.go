@@ -0,0 +1,47 @@
+package workrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// FieldChange is a field whose JSON value differs between two versions of a work
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// DiffFields returns the fields whose JSON value differs between two versions,
+// sorted by field name. A missing field is reported as null.
+func DiffFields(oldFields map[string]json.RawMessage, newFields map[string]json.RawMessage) []FieldChange {
+	names := map[string]bool{}
+	for name := range oldFields {
+		names[name] = true
+	}
+	for name := range newFields {
+		names[name] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	changes := []FieldChange{}
+	for _, name := range sortedNames {
+		oldValue, ok := oldFields[name]
+		if !ok {
+			oldValue = json.RawMessage("null")
+		}
+		newValue, ok := newFields[name]
+		if !ok {
+			newValue = json.RawMessage("null")
+		}
+		if !bytes.Equal(oldValue, newValue) {
+			changes = append(changes, FieldChange{Field: name, Old: oldValue, New: newValue})
+		}
+	}
+	return changes
+}
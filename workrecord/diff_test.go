@@ -0,0 +1,52 @@
+package workrecord
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decodeFields(t *testing.T, document string) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	if document == "" {
+		return fields
+	}
+	if err := json.Unmarshal([]byte(document), &fields); err != nil {
+		t.Fatalf("Unmarshal(%s): %s", document, err)
+	}
+	return fields
+}
+
+func TestDiffFields(t *testing.T) {
+	oldFields := decodeFields(t, `{"workId":"work1","status":"pending","reviewer":"Org2MSP:bob","workenddate":20180630180000}`)
+	newFields := decodeFields(t, `{"workId":"work1","status":"verified","workenddate":20180630180000,"reviewReason":"checked"}`)
+	changes := DiffFields(oldFields, newFields)
+
+	want := []FieldChange{
+		{Field: "reviewReason", Old: json.RawMessage("null"), New: json.RawMessage(`"checked"`)},
+		{Field: "reviewer", Old: json.RawMessage(`"Org2MSP:bob"`), New: json.RawMessage("null")},
+		{Field: "status", Old: json.RawMessage(`"pending"`), New: json.RawMessage(`"verified"`)},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffFields = %s, want %d changes", changesString(changes), len(want))
+	}
+	for i, change := range changes {
+		if change.Field != want[i].Field || string(change.Old) != string(want[i].Old) || string(change.New) != string(want[i].New) {
+			t.Errorf("change %d = %s %s -> %s, want %s %s -> %s", i, change.Field, change.Old, change.New, want[i].Field, want[i].Old, want[i].New)
+		}
+	}
+}
+
+func TestDiffFieldsOfCreation(t *testing.T) {
+	changes := DiffFields(nil, decodeFields(t, `{"workId":"work1"}`))
+	if len(changes) != 1 || changes[0].Field != "workId" || string(changes[0].Old) != "null" {
+		t.Errorf("DiffFields from nothing = %s, want workId from null", changesString(changes))
+	}
+	if changes := DiffFields(decodeFields(t, `{"workId":"work1"}`), decodeFields(t, `{"workId":"work1"}`)); changes == nil || len(changes) != 0 {
+		t.Errorf("DiffFields of equal versions = %v, want an empty list", changes)
+	}
+}
+
+func changesString(changes []FieldChange) string {
+	changesAsBytes, _ := json.Marshal(changes)
+	return string(changesAsBytes)
+}
@@ -0,0 +1,71 @@
+package workrecord
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tangsk/newchaincode/workdate"
+)
+
+// Period returns the period of a work. ok is false for works without valid
+// dates, such as private works or works filed before dates were validated.
+func Period(w *Work) (time.Time, time.Time, bool) {
+	start, err := workdate.ParseStored(w.Workstartdate)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := workdate.ParseStored(strconv.Itoa(w.Workenddate))
+	if err != nil || !end.After(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// Overlap reports whether two works with valid dates share any time.
+// A work ending when the other starts does not overlap it.
+func Overlap(a *Work, b *Work) bool {
+	aStart, aEnd, ok := Period(a)
+	if !ok {
+		return false
+	}
+	bStart, bEnd, ok := Period(b)
+	if !ok {
+		return false
+	}
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// ClaimsPeriod reports whether a work counts for overlaps, revoked and rejected works do not
+func ClaimsPeriod(w *Work) bool {
+	return w.Status != StatusRevoked && w.Status != StatusRejected
+}
+
+// Overlapping returns the works of others that claim a period overlapping the one of w.
+// w itself is skipped if it is among them.
+func Overlapping(w *Work, others []*Work) []*Work {
+	var overlapping []*Work
+	if !ClaimsPeriod(w) {
+		return overlapping
+	}
+	for _, other := range others {
+		if other.WorkId == w.WorkId || !ClaimsPeriod(other) {
+			continue
+		}
+		if Overlap(w, other) {
+			overlapping = append(overlapping, other)
+		}
+	}
+	return overlapping
+}
+
+// FlagConflict marks w as conflicting with the work otherId. A work already
+// listed is not listed again.
+func FlagConflict(w *Work, otherId string) {
+	w.Conflicting = true
+	for _, workId := range w.ConflictsWith {
+		if workId == otherId {
+			return
+		}
+	}
+	w.ConflictsWith = append(w.ConflictsWith, otherId)
+}
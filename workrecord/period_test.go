@@ -0,0 +1,80 @@
+package workrecord
+
+import (
+	"testing"
+)
+
+func newPeriodWork(workId string, start string, end int, status string) *Work {
+	return &Work{WorkId: workId, Workstartdate: start, Workenddate: end, Status: status}
+}
+
+func TestPeriod(t *testing.T) {
+	if _, _, ok := Period(newPeriodWork("work1", "20150301090000", 20180630180000, StatusPending)); !ok {
+		t.Errorf("Period rejected a valid work")
+	}
+	for _, w := range []*Work{
+		newPeriodWork("private", "", 0, StatusPending),
+		newPeriodWork("reversed", "20180630180000", 20150301090000, StatusPending),
+		newPeriodWork("empty", "20150301090000", 20150301090000, StatusPending),
+		newPeriodWork("baseline", "blue", 35, StatusPending),
+	} {
+		if _, _, ok := Period(w); ok {
+			t.Errorf("Period accepted %s", w.WorkId)
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	a := newPeriodWork("a", "20150101000000", 20160101000000, StatusVerified)
+	for _, tc := range []struct {
+		b    *Work
+		want bool
+	}{
+		{newPeriodWork("inside", "20150601000000", 20150701000000, StatusVerified), true},
+		{newPeriodWork("across", "20151201000000", 20170101000000, StatusVerified), true},
+		{newPeriodWork("adjacent", "20160101000000", 20170101000000, StatusVerified), false},
+		{newPeriodWork("before", "20140101000000", 20150101000000, StatusVerified), false},
+		{newPeriodWork("private", "", 0, StatusVerified), false},
+	} {
+		if got := Overlap(a, tc.b); got != tc.want {
+			t.Errorf("Overlap(a, %s) = %v, want %v", tc.b.WorkId, got, tc.want)
+		}
+		if got := Overlap(tc.b, a); got != tc.want {
+			t.Errorf("Overlap(%s, a) = %v, want %v", tc.b.WorkId, got, tc.want)
+		}
+	}
+}
+
+func TestOverlapping(t *testing.T) {
+	w := newPeriodWork("new", "20150101000000", 20160101000000, StatusPending)
+	others := []*Work{
+		newPeriodWork("new", "20150101000000", 20160101000000, StatusPending),
+		newPeriodWork("pending", "20150601000000", 20150701000000, StatusPending),
+		newPeriodWork("verified", "20151201000000", 20170101000000, StatusVerified),
+		newPeriodWork("rejected", "20150601000000", 20150701000000, StatusRejected),
+		newPeriodWork("revoked", "20150601000000", 20150701000000, StatusRevoked),
+		newPeriodWork("later", "20170101000000", 20180101000000, StatusVerified),
+	}
+	var got []string
+	for _, other := range Overlapping(w, others) {
+		got = append(got, other.WorkId)
+	}
+	if len(got) != 2 || got[0] != "pending" || got[1] != "verified" {
+		t.Errorf("Overlapping = %q, want pending and verified", got)
+	}
+
+	w.Status = StatusRevoked
+	if overlapping := Overlapping(w, others); len(overlapping) != 0 {
+		t.Errorf("a revoked work overlaps %d works", len(overlapping))
+	}
+}
+
+func TestFlagConflict(t *testing.T) {
+	w := newPeriodWork("a", "20150101000000", 20160101000000, StatusVerified)
+	FlagConflict(w, "b")
+	FlagConflict(w, "c")
+	FlagConflict(w, "b")
+	if !w.Conflicting || len(w.ConflictsWith) != 2 || w.ConflictsWith[0] != "b" || w.ConflictsWith[1] != "c" {
+		t.Errorf("FlagConflict left conflicting %v, conflictsWith %q", w.Conflicting, w.ConflictsWith)
+	}
+}
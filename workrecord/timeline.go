@@ -0,0 +1,107 @@
+package workrecord
+
+import (
+	"time"
+
+	"github.com/tangsk/newchaincode/workdate"
+)
+
+// Timeline is the employment history of a uid. Durations are whole days.
+// Tenures count time covered by several works once.
+// Only verified works count for gaps, tenures and the current employer. Pending
+// works are claims the employer has not attested yet, the time they cover is
+// reported apart as PendingTenureDays. Private works keep their dates off the
+// public record, so they are listed in PrivateWorks and are not part of the timeline.
+type Timeline struct {
+	Uid               string         `json:"uid"`
+	Works             []*Work        `json:"works"` //ordered by workstartdate
+	Gaps              []Gap          `json:"gaps"`
+	TotalTenureDays   int            `json:"totalTenureDays"`
+	TenureByEmployer  map[string]int `json:"tenureByEmployer"`  //days per employer MSP ID
+	PendingTenureDays int            `json:"pendingTenureDays"` //days claimed by pending works only
+	CurrentEmployer   string         `json:"currentEmployer,omitempty"`
+	PrivateWorks      []*Work        `json:"privateWorks"`
+}
+
+// Gap is a time between two verified works of a uid not covered by any of them
+type Gap struct {
+	Start string `json:"start"` //yyyyMMddHHmmss UTC
+	End   string `json:"end"`
+	Days  int    `json:"days"`
+}
+
+// NewTimeline builds the timeline of uid from its works with valid dates, ordered by
+// workstartdate. Revoked works are left out of Works unless includeRevoked is set.
+// The current employer is the one whose verified work covers now, the latest
+// started if several do.
+func NewTimeline(uid string, works []*Work, now time.Time, includeRevoked bool) *Timeline {
+	timeline := &Timeline{Uid: uid, Works: []*Work{}, Gaps: []Gap{}, TenureByEmployer: map[string]int{}, PrivateWorks: []*Work{}}
+	var total, pending time.Duration
+	var coveredUntil, pendingCoveredUntil time.Time
+	employerCoveredUntil := map[string]time.Time{}
+	employerTenure := map[string]time.Duration{}
+	var currentStart time.Time
+	for _, w := range works {
+		if includeRevoked || w.Status != StatusRevoked {
+			timeline.Works = append(timeline.Works, w)
+		}
+		start, end, ok := Period(w)
+		if !ok {
+			continue
+		}
+		if w.Status == StatusPending {
+			pending += uncovered(start, end, pendingCoveredUntil)
+			if end.After(pendingCoveredUntil) {
+				pendingCoveredUntil = end
+			}
+			continue
+		}
+		if w.Status != StatusVerified {
+			continue
+		}
+
+		// works are ordered by start, so only the part after the covered time is new
+		if !coveredUntil.IsZero() && start.After(coveredUntil) {
+			timeline.Gaps = append(timeline.Gaps, Gap{
+				Start: workdate.Format(coveredUntil),
+				End:   workdate.Format(start),
+				Days:  days(start.Sub(coveredUntil)),
+			})
+		}
+		total += uncovered(start, end, coveredUntil)
+		if end.After(coveredUntil) {
+			coveredUntil = end
+		}
+		employerTenure[w.Employer] += uncovered(start, end, employerCoveredUntil[w.Employer])
+		if end.After(employerCoveredUntil[w.Employer]) {
+			employerCoveredUntil[w.Employer] = end
+		}
+
+		if !start.After(now) && now.Before(end) && !start.Before(currentStart) {
+			timeline.CurrentEmployer = w.Employer
+			currentStart = start
+		}
+	}
+	timeline.TotalTenureDays = days(total)
+	timeline.PendingTenureDays = days(pending)
+	for employer, tenure := range employerTenure {
+		timeline.TenureByEmployer[employer] = days(tenure)
+	}
+	return timeline
+}
+
+// uncovered returns the part of the period from start to end that lies after coveredUntil
+func uncovered(start time.Time, end time.Time, coveredUntil time.Time) time.Duration {
+	if start.Before(coveredUntil) {
+		start = coveredUntil
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// days returns the whole days of a duration
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
@@ -0,0 +1,69 @@
+package workrecord
+
+import (
+	"testing"
+	"time"
+)
+
+func newTimelineWork(workId string, start string, end int, employer string, status string) *Work {
+	return &Work{WorkId: workId, Workstartdate: start, Workenddate: end, Employer: employer, Status: status}
+}
+
+func TestNewTimeline(t *testing.T) {
+	works := []*Work{
+		newTimelineWork("w1", "20150101000000", 20150301000000, "Org2MSP", StatusVerified), //59 days
+		newTimelineWork("w2", "20150201000000", 20150401000000, "Org3MSP", StatusVerified), //overlaps w1 by 28 days
+		newTimelineWork("w3", "20150501000000", 20150601000000, "Org2MSP", StatusPending),  //claimed only
+		newTimelineWork("w4", "20150601000000", 20150701000000, "Org2MSP", StatusRejected), //never counts
+		newTimelineWork("w5", "20150801000000", 20160801000000, "Org2MSP", StatusRevoked),  //never counts
+		newTimelineWork("w6", "20150901000000", 20151001000000, "Org3MSP", StatusVerified), //30 days
+	}
+	now := time.Date(2015, time.September, 15, 0, 0, 0, 0, time.UTC)
+	timeline := NewTimeline("u1", works, now, false)
+
+	if len(timeline.Works) != 5 {
+		t.Errorf("Works has %d works, want all but the revoked one", len(timeline.Works))
+	}
+	if timeline.TotalTenureDays != 90+30 {
+		t.Errorf("TotalTenureDays = %d, want 120", timeline.TotalTenureDays)
+	}
+	if timeline.TenureByEmployer["Org2MSP"] != 59 || timeline.TenureByEmployer["Org3MSP"] != 59+30 {
+		t.Errorf("TenureByEmployer = %v, want Org2MSP 59 and Org3MSP 89", timeline.TenureByEmployer)
+	}
+	if timeline.PendingTenureDays != 31 {
+		t.Errorf("PendingTenureDays = %d, want 31", timeline.PendingTenureDays)
+	}
+	// the pending, rejected and revoked works leave the time between w2 and w6 uncovered
+	if len(timeline.Gaps) != 1 || timeline.Gaps[0].Start != "20150401000000" || timeline.Gaps[0].End != "20150901000000" || timeline.Gaps[0].Days != 153 {
+		t.Errorf("Gaps = %+v, want one from 20150401000000 to 20150901000000", timeline.Gaps)
+	}
+	if timeline.CurrentEmployer != "Org3MSP" {
+		t.Errorf("CurrentEmployer = %q, want Org3MSP", timeline.CurrentEmployer)
+	}
+
+	timeline = NewTimeline("u1", works, now, true)
+	if len(timeline.Works) != 6 {
+		t.Errorf("Works has %d works with includeRevoked, want 6", len(timeline.Works))
+	}
+}
+
+func TestNewTimelineCurrentEmployerIsVerified(t *testing.T) {
+	works := []*Work{
+		newTimelineWork("w1", "20150101000000", 20200101000000, "Org2MSP", StatusVerified),
+		newTimelineWork("w2", "20180101000000", 20200101000000, "Org3MSP", StatusPending),
+	}
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if got := NewTimeline("u1", works, now, false).CurrentEmployer; got != "Org2MSP" {
+		t.Errorf("CurrentEmployer = %q, want the verified Org2MSP", got)
+	}
+}
+
+func TestNewTimelineEmpty(t *testing.T) {
+	timeline := NewTimeline("u1", nil, time.Now(), false)
+	if timeline.Works == nil || timeline.Gaps == nil || timeline.TenureByEmployer == nil || timeline.PrivateWorks == nil {
+		t.Errorf("empty timeline has nil lists: %+v", timeline)
+	}
+	if timeline.TotalTenureDays != 0 || timeline.CurrentEmployer != "" {
+		t.Errorf("empty timeline = %+v", timeline)
+	}
+}
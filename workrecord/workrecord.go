@@ -0,0 +1,173 @@
+// Package workrecord defines the work document of the works chaincode, its indexes
+// and the migration of documents written in older layouts.
+//
+// Two layouts came before schemaVersion 1:
+//
+//	the baseline layout: docType, uid, workstartdate, workenddate, workexperience.
+//	  The document is keyed by uid, which names the work, and indexed under workstartdate~uid.
+//	the layout of the attestation workflow before schemaVersion: workId is the key of the
+//	  document and uid the candidate it belongs to, with an employer and a status.
+//
+// Decode tells them apart by workId, which the baseline layout does not have.
+package workrecord
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/tangsk/newchaincode/compositeindex"
+)
+
+// Work is the public record of a work of a candidate
+type Work struct {
+	ObjectType     string `json:"docType"`       //docType is used to distinguish the various types of objects in state database
+	SchemaVersion  int    `json:"schemaVersion"` //layout of the document, see Decode
+	WorkId         string `json:"workId"`        //the fieldtags are needed to keep case from bouncing around
+	Workstartdate  string `json:"workstartdate"`
+	Workenddate    int    `json:"workenddate"`
+	Workexperience string `json:"workexperience"`
+	CandidateUid   string `json:"candidateUid"` //uid of the candidate the work record belongs to
+	Employer       string `json:"employer"`     //MSP ID of the employer org that has to attest the record
+	Status         string `json:"status"`       //pending, verified, rejected or revoked
+	Claimant       string `json:"claimant"`     //resolved name of the identity that filed the work
+	Reviewer       string `json:"reviewer,omitempty"`
+	ReviewReason   string `json:"reviewReason,omitempty"`
+	RevokedReason  string `json:"revokedReason,omitempty"` //one of the revocation reason codes
+	RevokedBy      string `json:"revokedBy,omitempty"`
+	RevokedAt      string `json:"revokedAt,omitempty"` //tx timestamp of the revocation, RFC3339
+	//set under the flag overlap policy when the period overlaps other works of the uid
+	Conflicting   bool     `json:"conflicting,omitempty"`
+	ConflictsWith []string `json:"conflictsWith,omitempty"`
+	//works filed with initWorkPrivate keep workstartdate, workenddate and workexperience
+	//in collectionWorkPrivateDetails, the public record only carries their salted hashes
+	Hash        string            `json:"hash,omitempty"`
+	FieldHashes map[string]string `json:"fieldHashes,omitempty"`
+}
+
+// SchemaVersion is the current layout of work documents. Works written before
+// schemaVersion was introduced have none and are read as version 0 by Decode.
+const SchemaVersion = 1
+
+// Attestation states of a work record. A candidate files a claim as pending,
+// the employer org named on the record moves it to verified or rejected.
+// A revoked work stays on the ledger but is hidden from queries by default.
+const (
+	StatusPending  = "pending"
+	StatusVerified = "verified"
+	StatusRejected = "rejected"
+	StatusRevoked  = "revoked"
+)
+
+// Names of the composite key indexes of works
+const (
+	StartIndex       = "workstartdate~workId"
+	UidStartIndex    = "uid~workstartdate~workId"
+	UidEmployerIndex = "uid~employer~workId"
+	EmployerUidIndex = "employer~uid~workId"
+	LegacyStartIndex = "workstartdate~uid" //baseline layout, see DeleteLegacyIndexEntry
+)
+
+// Indexes declares the composite key indexes of works. Works are written and
+// deleted through it so the index entries follow every change.
+// The composite key is based on indexName~workstartdate~workId, enabling efficient
+// range queries on keys matching indexName~workstartdate~*.
+// uid~workstartdate~workId lists the works of a person in the order they started.
+// The public record of a private work has no workstartdate and so is not indexed by it.
+// uid~employer~workId and employer~uid~workId list the works of a person or of an employer,
+// private works included.
+var Indexes = compositeindex.NewManager("work",
+	compositeindex.Index{Name: StartIndex, Fields: []string{"workstartdate", "workId"}},
+	compositeindex.Index{Name: UidStartIndex, Fields: []string{"candidateUid", "workstartdate", "workId"}},
+	compositeindex.Index{Name: UidEmployerIndex, Fields: []string{"candidateUid", "employer", "workId"}},
+	compositeindex.Index{Name: EmployerUidIndex, Fields: []string{"employer", "candidateUid", "workId"}},
+)
+
+// Decode reads a work document stored under workId in any layout it was ever
+// written in and fills w in the current one
+func Decode(workId string, value []byte, w *Work) error {
+	var fields struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		WorkId        string `json:"workId"`
+		Uid           string `json:"uid"`
+	}
+	err := json.Unmarshal(value, &fields)
+	if err != nil {
+		return err
+	}
+	if fields.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("Unknown schemaVersion %d", fields.SchemaVersion)
+	}
+	err = json.Unmarshal(value, w)
+	if err != nil {
+		return err
+	}
+	if fields.SchemaVersion == SchemaVersion {
+		return nil
+	}
+
+	if fields.WorkId == "" {
+		// the baseline layout: uid is the key of the work, the candidate is not known
+		w.WorkId = workId
+	} else {
+		w.CandidateUid = fields.Uid
+	}
+	if w.ObjectType == "" {
+		w.ObjectType = "work"
+	}
+	// works written before the attestation workflow were never reviewed
+	if w.Status == "" {
+		w.Status = StatusPending
+	}
+	w.SchemaVersion = SchemaVersion
+	return nil
+}
+
+// NeedsMigration reports whether a document may be a work written in an older layout.
+// Documents of other types and works in the current layout need none.
+func NeedsMigration(value []byte) bool {
+	var version struct {
+		ObjectType    string `json:"docType"`
+		SchemaVersion int    `json:"schemaVersion"`
+	}
+	if json.Unmarshal(value, &version) == nil && version.SchemaVersion == SchemaVersion {
+		return false
+	}
+	return version.ObjectType == "" || version.ObjectType == "work"
+}
+
+// Migrate rewrites the document value stored under workId as w, the result of Decode,
+// and moves its index entries, those of the baseline layout included
+func Migrate(stub shim.ChaincodeStubInterface, workId string, value []byte, w *Work) error {
+	migratedAsBytes, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	err = DeleteLegacyIndexEntry(stub, value)
+	if err != nil {
+		return err
+	}
+	return Indexes.PutState(stub, workId, migratedAsBytes) //rewrite the work and move its index entries
+}
+
+// DeleteLegacyIndexEntry deletes the workstartdate~uid entry of a work document in the
+// baseline layout. That index is not one of Indexes, so PutState leaves it behind.
+func DeleteLegacyIndexEntry(stub shim.ChaincodeStubInterface, value []byte) error {
+	var legacy struct {
+		WorkId        string `json:"workId"`
+		Uid           string `json:"uid"`
+		Workstartdate string `json:"workstartdate"`
+	}
+	if json.Unmarshal(value, &legacy) != nil || legacy.WorkId != "" || legacy.Uid == "" {
+		return nil
+	}
+	indexKey, err := stub.CreateCompositeKey(LegacyStartIndex, []string{legacy.Workstartdate, legacy.Uid})
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("Failed to delete legacy index entry: %s", err)
+	}
+	return nil
+}
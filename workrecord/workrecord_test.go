@@ -0,0 +1,179 @@
+package workrecord
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func partialKeys(t *testing.T, stub *shim.MockStub, indexName string, attributes ...string) []string {
+	iterator, err := stub.GetStateByPartialCompositeKey(indexName, attributes)
+	if err != nil {
+		t.Fatalf("GetStateByPartialCompositeKey %s: %s", indexName, err)
+	}
+	defer iterator.Close()
+	var keys []string
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestDecodeBaselineLayout(t *testing.T) {
+	value := []byte(`{"docType":"work","uid":"work1","workstartdate":"20150301090000","workenddate":20180630180000,"workexperience":"tom"}`)
+	var w Work
+	err := Decode("work1", value, &w)
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if w.WorkId != "work1" {
+		t.Errorf("WorkId = %q, want the key work1", w.WorkId)
+	}
+	if w.CandidateUid != "" {
+		t.Errorf("CandidateUid = %q, the uid of the baseline layout names the work", w.CandidateUid)
+	}
+	if w.Status != StatusPending || w.SchemaVersion != SchemaVersion || w.ObjectType != "work" {
+		t.Errorf("unexpected status %q, schemaVersion %d, docType %q", w.Status, w.SchemaVersion, w.ObjectType)
+	}
+	if w.Workstartdate != "20150301090000" || w.Workenddate != 20180630180000 || w.Workexperience != "tom" {
+		t.Errorf("baseline fields not kept: %+v", w)
+	}
+}
+
+func TestDecodeWorkflowLayout(t *testing.T) {
+	value := []byte(`{"docType":"work","workId":"work1","uid":"c4ca4238a0b923820dcc509a6f75849b","workstartdate":"20150301090000","workenddate":20180630180000,"workexperience":"tom","employer":"Org2MSP","status":"verified"}`)
+	var w Work
+	err := Decode("work1", value, &w)
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if w.WorkId != "work1" || w.CandidateUid != "c4ca4238a0b923820dcc509a6f75849b" {
+		t.Errorf("WorkId %q, CandidateUid %q, want work1 and the uid", w.WorkId, w.CandidateUid)
+	}
+	if w.Status != StatusVerified {
+		t.Errorf("Status = %q, want the stored verified", w.Status)
+	}
+}
+
+func TestDecodeCurrentAndUnknownVersions(t *testing.T) {
+	var w Work
+	err := Decode("work1", []byte(`{"docType":"work","schemaVersion":1,"workId":"work1","candidateUid":"u1","status":"pending"}`), &w)
+	if err != nil || w.CandidateUid != "u1" {
+		t.Errorf("Decode of the current layout = %+v, %v", w, err)
+	}
+	err = Decode("work1", []byte(`{"docType":"work","schemaVersion":2,"workId":"work1"}`), &w)
+	if err == nil {
+		t.Errorf("Decode accepted an unknown schemaVersion")
+	}
+}
+
+func TestNeedsMigration(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  bool
+	}{
+		{`{"docType":"work","uid":"work1"}`, true},
+		{`{"uid":"work1"}`, true},
+		{`{"docType":"work","schemaVersion":1}`, false},
+		{`{"docType":"grant","uid":"u1"}`, false},
+		{`not json`, true},
+	} {
+		if got := NeedsMigration([]byte(tc.value)); got != tc.want {
+			t.Errorf("NeedsMigration(%s) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestMigrateBaselineWork(t *testing.T) {
+	stub := shim.NewMockStub("workrecord", nil)
+	stub.MockTransactionStart("tx1")
+
+	// a work and its index entry as the baseline chaincode wrote them
+	value := []byte(`{"docType":"work","uid":"work1","workstartdate":"20150301090000","workenddate":20180630180000,"workexperience":"tom"}`)
+	err := stub.PutState("work1", value)
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	legacyKey, err := stub.CreateCompositeKey(LegacyStartIndex, []string{"20150301090000", "work1"})
+	if err != nil {
+		t.Fatalf("CreateCompositeKey: %s", err)
+	}
+	err = stub.PutState(legacyKey, []byte{0x00})
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+
+	if !NeedsMigration(value) {
+		t.Fatalf("baseline work does not need migration")
+	}
+	var migrated Work
+	err = Decode("work1", value, &migrated)
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	err = Migrate(stub, "work1", value, &migrated)
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+
+	stored := map[string]interface{}{}
+	err = json.Unmarshal(stub.State["work1"], &stored)
+	if err != nil {
+		t.Fatalf("migrated work is not JSON: %s", err)
+	}
+	if stored["workId"] != "work1" || stored["candidateUid"] != "" || stored["schemaVersion"] != float64(SchemaVersion) {
+		t.Errorf("unexpected migrated work %s", stub.State["work1"])
+	}
+	if _, ok := stored["uid"]; ok {
+		t.Errorf("migrated work still holds uid: %s", stub.State["work1"])
+	}
+	if NeedsMigration(stub.State["work1"]) {
+		t.Errorf("migrated work still needs migration")
+	}
+
+	if keys := partialKeys(t, stub, LegacyStartIndex); len(keys) != 0 {
+		t.Errorf("legacy workstartdate~uid entries left behind: %q", keys)
+	}
+	startKey, _ := stub.CreateCompositeKey(StartIndex, []string{"20150301090000", "work1"})
+	if keys := partialKeys(t, stub, StartIndex); len(keys) != 1 || keys[0] != startKey {
+		t.Errorf("workstartdate~workId entries = %q, want %q", keys, startKey)
+	}
+	// without a candidate the work is in no uid index
+	if keys := partialKeys(t, stub, UidStartIndex); len(keys) != 0 {
+		t.Errorf("baseline work indexed by uid: %q", keys)
+	}
+}
+
+func TestMigrateWorkflowWork(t *testing.T) {
+	stub := shim.NewMockStub("workrecord", nil)
+	stub.MockTransactionStart("tx1")
+
+	value := []byte(`{"docType":"work","workId":"work1","uid":"u1","workstartdate":"20150301090000","workenddate":20180630180000,"workexperience":"tom","employer":"Org2MSP","status":"pending"}`)
+	err := stub.PutState("work1", value)
+	if err != nil {
+		t.Fatalf("PutState: %s", err)
+	}
+	var migrated Work
+	err = Decode("work1", value, &migrated)
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	err = Migrate(stub, "work1", value, &migrated)
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+
+	uidKey, _ := stub.CreateCompositeKey(UidEmployerIndex, []string{"u1", "Org2MSP", "work1"})
+	if keys := partialKeys(t, stub, UidEmployerIndex, "u1"); len(keys) != 1 || keys[0] != uidKey {
+		t.Errorf("uid~employer~workId entries = %q, want %q", keys, uidKey)
+	}
+	employerKey, _ := stub.CreateCompositeKey(EmployerUidIndex, []string{"Org2MSP", "u1", "work1"})
+	if keys := partialKeys(t, stub, EmployerUidIndex, "Org2MSP"); len(keys) != 1 || keys[0] != employerKey {
+		t.Errorf("employer~uid~workId entries = %q, want %q", keys, employerKey)
+	}
+}